@@ -26,6 +26,7 @@ func Command() {
 	registerCompile(app)
 	registerExec(app)
 	registerCopy(app)
+	registerProxy(app)
 	daemon.Register(app)
 
 	kingpin.Version(version)
@@ -12,6 +12,7 @@ import (
 	"strings"
 
 	"github.com/drone-runners/drone-runner-docker/command/internal"
+	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/compiler"
 	"github.com/drone-runners/drone-runner-docker/engine/linter"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
@@ -37,6 +38,7 @@ type compileCommand struct {
 	Labels     map[string]string
 	Secrets    map[string]string
 	Resources  compiler.Resources
+	Ulimits    map[string]string
 	Tmate      compiler.Tmate
 	Clone      bool
 	Config     string
@@ -97,6 +99,13 @@ func (c *compileCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
+	// parse the runner ulimits, which are applied to steps
+	// that do not define ulimits.
+	c.Resources.Ulimits, err = engine.ParseUlimits(c.Ulimits)
+	if err != nil {
+		return err
+	}
+
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
 		Environ:    provider.Static(c.Environ),
@@ -192,6 +201,12 @@ func registerCompile(app *kingpin.Application) {
 	cmd.Flag("memory-swap", "container memory swap limit").
 		Int64Var(&c.Resources.MemorySwap)
 
+	cmd.Flag("pids-limit", "container pids limit").
+		Int64Var(&c.Resources.PidsLimit)
+
+	cmd.Flag("ulimits", "container ulimits").
+		StringMapVar(&c.Ulimits)
+
 	cmd.Flag("docker-config", "path to the docker config file").
 		StringVar(&c.Config)
 
@@ -5,8 +5,11 @@
 package daemon
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -55,6 +58,12 @@ type Config struct {
 		NetworkOpts map[string]string `envconfig:"DRONE_RUNNER_NETWORK_OPTS"`
 		Privileged  []string          `envconfig:"DRONE_RUNNER_PRIVILEGED_IMAGES"`
 		Clone       string            `envconfig:"DRONE_RUNNER_CLONE_IMAGE"`
+		ArtifactDir string            `envconfig:"DRONE_RUNNER_ARTIFACT_DIR"`
+		StopSignal  string            `envconfig:"DRONE_RUNNER_STOP_SIGNAL"`
+		StopGrace   time.Duration     `envconfig:"DRONE_RUNNER_STOP_GRACE_PERIOD"`
+
+		Runtime          string `envconfig:"DRONE_RUNNER_RUNTIME"`
+		RuntimeUntrusted string `envconfig:"DRONE_RUNNER_RUNTIME_UNTRUSTED"`
 	}
 
 	Platform struct {
@@ -78,6 +87,16 @@ type Config struct {
 		CPUShares  int64    `envconfig:"DRONE_CPU_SHARES"`
 		CPUSet     []string `envconfig:"DRONE_CPU_SET"`
 		ShmSize    int64    `envconfig:"DRONE_SHM_SIZE"`
+
+		PidsLimit int64             `envconfig:"DRONE_PIDS_LIMIT"`
+		Ulimits   map[string]string `envconfig:"DRONE_ULIMITS"`
+	}
+
+	Hardening struct {
+		Enabled   bool     `envconfig:"DRONE_HARDENING_ENABLED"`
+		CapAdd    []string `envconfig:"DRONE_HARDENING_CAP_ADD"`
+		PidsLimit int64    `envconfig:"DRONE_HARDENING_PIDS_LIMIT"`
+		Seccomp   string   `envconfig:"DRONE_HARDENING_SECCOMP_PROFILE"`
 	}
 
 	Environ struct {
@@ -103,8 +122,28 @@ type Config struct {
 	}
 
 	Docker struct {
-		Config string `envconfig:"DRONE_DOCKER_CONFIG"`
-		Stream bool   `envconfig:"DRONE_DOCKER_STREAM_PULL" default:"true"`
+		Config          string `envconfig:"DRONE_DOCKER_CONFIG"`
+		Stream          bool   `envconfig:"DRONE_DOCKER_STREAM_PULL" default:"true"`
+		PullConcurrency int    `envconfig:"DRONE_DOCKER_PULL_CONCURRENCY"`
+		PullPolicy      string `envconfig:"DRONE_DOCKER_PULL_POLICY"`
+		PullRecord      string `envconfig:"DRONE_DOCKER_PULL_RECORD"`
+		PullRetries     int    `envconfig:"DRONE_DOCKER_PULL_RETRIES" default:"3"`
+	}
+
+	DockerProxy struct {
+		Enabled bool   `envconfig:"DRONE_DOCKER_PROXY_ENABLED"`
+		Image   string `envconfig:"DRONE_DOCKER_PROXY_IMAGE" default:"drone/drone-runner-docker:1"`
+	}
+
+	Cache struct {
+		MaxSize int64  `envconfig:"DRONE_CACHE_MAX_SIZE"`
+		Record  string `envconfig:"DRONE_CACHE_RECORD"`
+	}
+
+	Janitor struct {
+		Disabled bool          `envconfig:"DRONE_JANITOR_DISABLED"`
+		Interval time.Duration `envconfig:"DRONE_JANITOR_INTERVAL" default:"1h"`
+		MaxAge   time.Duration `envconfig:"DRONE_JANITOR_MAX_AGE"  default:"24h"`
 	}
 
 	Tmate struct {
@@ -188,5 +227,18 @@ func fromEnviron() (Config, error) {
 		}
 	}
 
+	// the seccomp profile is sourced from a separate file.
+	// the file contents are passed to the docker daemon.
+	if file := config.Hardening.Seccomp; file != "" {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return config, err
+		}
+		if !json.Valid(raw) {
+			return config, fmt.Errorf("invalid seccomp profile: %s", file)
+		}
+		config.Hardening.Seccomp = string(raw)
+	}
+
 	return config, nil
 }
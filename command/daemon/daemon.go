@@ -81,8 +81,25 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		),
 	)
 
+	ulimits, err := engine.ParseUlimits(config.Resources.Ulimits)
+	if err != nil {
+		logrus.WithError(err).
+			Fatalln("invalid ulimit configuration")
+	}
+
+	if _, _, err := engine.ParsePullPolicy(config.Docker.PullPolicy); err != nil {
+		logrus.WithError(err).
+			Fatalln("invalid pull policy configuration")
+	}
+
 	opts := engine.Opts{
-		HidePull: !config.Docker.Stream,
+		HidePull:        !config.Docker.Stream,
+		PullConcurrency: config.Docker.PullConcurrency,
+		PullRecord:      config.Docker.PullRecord,
+		PullRetries:     config.Docker.PullRetries,
+		ArtifactDir:     config.Runner.ArtifactDir,
+		CacheMaxSize:    config.Cache.MaxSize,
+		CacheRecord:     config.Cache.Record,
 	}
 	engine, err := engine.NewEnv(opts)
 	if err != nil {
@@ -128,12 +145,17 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 			config.Limit.Trusted,
 		),
 		Compiler: &compiler.Compiler{
-			Clone:          config.Runner.Clone,
-			Privileged:     append(config.Runner.Privileged, compiler.Privileged...),
-			Networks:       config.Runner.Networks,
-			NetworkOpts:    config.Runner.NetworkOpts,
-			NetrcCloneOnly: config.Netrc.CloneOnly,
-			Volumes:        config.Runner.Volumes,
+			Clone:            config.Runner.Clone,
+			Privileged:       append(config.Runner.Privileged, compiler.Privileged...),
+			Networks:         config.Runner.Networks,
+			NetworkOpts:      config.Runner.NetworkOpts,
+			NetrcCloneOnly:   config.Netrc.CloneOnly,
+			Volumes:          config.Runner.Volumes,
+			Runtime:          config.Runner.Runtime,
+			RuntimeUntrusted: config.Runner.RuntimeUntrusted,
+			PullPolicy:       config.Docker.PullPolicy,
+			StopSignal:       config.Runner.StopSignal,
+			StopGrace:        config.Runner.StopGrace,
 			Resources: compiler.Resources{
 				Memory:     config.Resources.Memory,
 				MemorySwap: config.Resources.MemorySwap,
@@ -142,6 +164,18 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 				CPUShares:  config.Resources.CPUShares,
 				CPUSet:     config.Resources.CPUSet,
 				ShmSize:    config.Resources.ShmSize,
+				PidsLimit:  config.Resources.PidsLimit,
+				Ulimits:    ulimits,
+			},
+			DockerProxy: compiler.DockerProxy{
+				Enabled: config.DockerProxy.Enabled,
+				Image:   config.DockerProxy.Image,
+			},
+			Hardening: compiler.Hardening{
+				Enabled:   config.Hardening.Enabled,
+				CapAdd:    config.Hardening.CapAdd,
+				PidsLimit: config.Hardening.PidsLimit,
+				Seccomp:   config.Hardening.Seccomp,
 			},
 			Tmate: compiler.Tmate{
 				Image:          config.Tmate.Image,
@@ -243,6 +277,17 @@ func (c *daemonCommand) run(*kingpin.ParseContext) error {
 		}
 	}
 
+	if !config.Janitor.Disabled {
+		g.Go(func() error {
+			logrus.WithField("interval", config.Janitor.Interval).
+				WithField("max-age", config.Janitor.MaxAge).
+				Infoln("starting the janitor")
+
+			janitor(ctx, engine, config.Janitor.Interval, config.Janitor.MaxAge)
+			return nil
+		})
+	}
+
 	g.Go(func() error {
 		logrus.WithField("capacity", config.Runner.Capacity).
 			WithField("endpoint", config.Client.Address).
@@ -0,0 +1,47 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package daemon
+
+import (
+	"context"
+	"time"
+
+	"github.com/drone-runners/drone-runner-docker/engine"
+
+	"github.com/sirupsen/logrus"
+)
+
+// helper function periodically reclaims the orphaned pipeline
+// resources until the context is cancelled. Resources are first
+// reclaimed on startup, since resources are typically orphaned
+// when the runner process exits.
+func janitor(ctx context.Context, engine *engine.Docker, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		reclaim(ctx, engine, maxAge)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// helper function reclaims the orphaned pipeline resources.
+func reclaim(ctx context.Context, engine *engine.Docker, maxAge time.Duration) {
+	reclaimed, err := engine.Reclaim(ctx, maxAge)
+	if err != nil {
+		logrus.WithError(err).
+			Errorln("janitor: cannot reclaim orphaned resources")
+	}
+	if reclaimed.Len() == 0 {
+		return
+	}
+	logrus.WithField("containers", reclaimed.Containers).
+		WithField("volumes", reclaimed.Volumes).
+		WithField("networks", reclaimed.Networks).
+		Infof("janitor: reclaimed %d orphaned resources", reclaimed.Len())
+}
@@ -53,8 +53,23 @@ func (c *processCommand) run(*kingpin.ParseContext) error {
 		),
 	)
 
+	ulimits, err := engine.ParseUlimits(config.Resources.Ulimits)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err := engine.ParsePullPolicy(config.Docker.PullPolicy); err != nil {
+		return err
+	}
+
 	opts := engine.Opts{
-		HidePull: !config.Docker.Stream,
+		HidePull:        !config.Docker.Stream,
+		PullConcurrency: config.Docker.PullConcurrency,
+		PullRecord:      config.Docker.PullRecord,
+		PullRetries:     config.Docker.PullRetries,
+		ArtifactDir:     config.Runner.ArtifactDir,
+		CacheMaxSize:    config.Cache.MaxSize,
+		CacheRecord:     config.Cache.Record,
 	}
 	engine, err := engine.NewEnv(opts)
 	if err != nil {
@@ -74,11 +89,16 @@ func (c *processCommand) run(*kingpin.ParseContext) error {
 		Lint:     linter.New().Lint,
 		Match:    nil,
 		Compiler: &compiler.Compiler{
-			Clone:          config.Runner.Clone,
-			Privileged:     append(config.Runner.Privileged, compiler.Privileged...),
-			Networks:       config.Runner.Networks,
-			NetrcCloneOnly: config.Netrc.CloneOnly,
-			Volumes:        config.Runner.Volumes,
+			Clone:            config.Runner.Clone,
+			Privileged:       append(config.Runner.Privileged, compiler.Privileged...),
+			Networks:         config.Runner.Networks,
+			NetrcCloneOnly:   config.Netrc.CloneOnly,
+			Volumes:          config.Runner.Volumes,
+			Runtime:          config.Runner.Runtime,
+			RuntimeUntrusted: config.Runner.RuntimeUntrusted,
+			PullPolicy:       config.Docker.PullPolicy,
+			StopSignal:       config.Runner.StopSignal,
+			StopGrace:        config.Runner.StopGrace,
 			Resources: compiler.Resources{
 				Memory:     config.Resources.Memory,
 				MemorySwap: config.Resources.MemorySwap,
@@ -87,6 +107,18 @@ func (c *processCommand) run(*kingpin.ParseContext) error {
 				CPUShares:  config.Resources.CPUShares,
 				CPUSet:     config.Resources.CPUSet,
 				ShmSize:    config.Resources.ShmSize,
+				PidsLimit:  config.Resources.PidsLimit,
+				Ulimits:    ulimits,
+			},
+			DockerProxy: compiler.DockerProxy{
+				Enabled: config.DockerProxy.Enabled,
+				Image:   config.DockerProxy.Image,
+			},
+			Hardening: compiler.Hardening{
+				Enabled:   config.Hardening.Enabled,
+				CapAdd:    config.Hardening.CapAdd,
+				PidsLimit: config.Hardening.PidsLimit,
+				Seccomp:   config.Hardening.Seccomp,
 			},
 			Environ: provider.Combine(
 				provider.Static(config.Runner.Environ),
@@ -50,6 +50,7 @@ type execCommand struct {
 	Labels     map[string]string
 	Secrets    map[string]string
 	Resources  compiler.Resources
+	Ulimits    map[string]string
 	Tmate      compiler.Tmate
 	Clone      bool
 	Config     string
@@ -60,6 +61,7 @@ type execCommand struct {
 	Dump       bool
 	PublicKey  string
 	PrivateKey string
+	Artifacts  string
 }
 
 func (c *execCommand) run(*kingpin.ParseContext) error {
@@ -117,6 +119,13 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		return err
 	}
 
+	// parse the runner ulimits, which are applied to steps
+	// that do not define ulimits.
+	c.Resources.Ulimits, err = engine.ParseUlimits(c.Ulimits)
+	if err != nil {
+		return err
+	}
+
 	// compile the pipeline to an intermediate representation.
 	comp := &compiler.Compiler{
 		Environ:    provider.Static(c.Environ),
@@ -231,21 +240,33 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 		),
 	)
 
-	engine, err := engine.NewEnv(engine.Opts{})
+	engine, err := engine.NewEnv(engine.Opts{
+		ArtifactDir: c.Artifacts,
+	})
 	if err != nil {
 		return err
 	}
 
+	// the section markers are removed from the logs when
+	// the logs are pretty printed to the console.
+	var streamer pipeline.Streamer = console.New(c.Pretty)
+	if c.Pretty {
+		streamer = &sectionStreamer{base: streamer}
+	}
+
 	err = runtime.NewExecer(
 		pipeline.NopReporter(),
-		console.New(c.Pretty),
+		streamer,
 		pipeline.NopUploader(),
 		engine,
 		c.Procs,
 	).Exec(ctx, spec, state)
 
 	if c.Dump {
-		dump(state)
+		dump(&dumpState{
+			State:   state,
+			Results: spec.Results(),
+		})
 	}
 	if err != nil {
 		return err
@@ -257,6 +278,13 @@ func (c *execCommand) run(*kingpin.ParseContext) error {
 	return nil
 }
 
+// dumpState combines the pipeline state with the step
+// results recorded by the engine for the --dump output.
+type dumpState struct {
+	*pipeline.State
+	Results []*engine.Result `json:"Results,omitempty"`
+}
+
 func dump(v interface{}) {
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
@@ -322,12 +350,21 @@ func registerExec(app *kingpin.Application) {
 	cmd.Flag("memory-swap", "container memory swap limit").
 		Int64Var(&c.Resources.MemorySwap)
 
+	cmd.Flag("pids-limit", "container pids limit").
+		Int64Var(&c.Resources.PidsLimit)
+
+	cmd.Flag("ulimits", "container ulimits").
+		StringMapVar(&c.Ulimits)
+
 	cmd.Flag("public-key", "public key file path").
 		ExistingFileVar(&c.PublicKey)
 
 	cmd.Flag("private-key", "private key file path").
 		ExistingFileVar(&c.PrivateKey)
 
+	cmd.Flag("artifacts-dir", "directory the step artifacts are exported to").
+		StringVar(&c.Artifacts)
+
 	cmd.Flag("docker-config", "path to the docker config file").
 		StringVar(&c.Config)
 
@@ -0,0 +1,106 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/drone-runners/drone-runner-docker/internal/docker/proxy"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type proxyCommand struct {
+	docker string
+	socket string
+	label  string
+	repos  []string
+	ping   bool
+}
+
+func (c *proxyCommand) run(*kingpin.ParseContext) error {
+	if c.ping {
+		return c.pingSocket()
+	}
+
+	parts := strings.SplitN(c.label, "=", 2)
+	if len(parts) != 2 {
+		return errors.New("invalid proxy label")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.socket), 0755); err != nil {
+		return err
+	}
+	os.Remove(c.socket)
+	listener, err := net.Listen("unix", c.socket)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	// the socket is accessible to all users, since pipeline
+	// steps may not execute as the root user.
+	if err := os.Chmod(c.socket, 0666); err != nil {
+		return err
+	}
+	return http.Serve(listener, proxy.New(c.docker, parts[0], parts[1], c.repos))
+}
+
+// helper function pings the docker daemon through the proxy
+// socket, which returns an error if the proxy is not ready.
+func (c *proxyCommand) pingSocket() error {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", c.socket)
+			},
+		},
+	}
+	res, err := client.Get("http://docker/_ping")
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy ping failed with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Register registers the proxy command.
+func registerProxy(app *kingpin.Application) {
+	c := new(proxyCommand)
+
+	cmd := app.Command("proxy", "docker socket proxy").
+		Hidden().
+		Action(c.run)
+
+	cmd.Flag("docker", "docker socket path").
+		Default("/var/run/docker.sock").
+		StringVar(&c.docker)
+
+	cmd.Flag("socket", "proxy socket path").
+		Default("/run/drone/docker.sock").
+		StringVar(&c.socket)
+
+	cmd.Flag("label", "image label identifying the stage").
+		StringVar(&c.label)
+
+	cmd.Flag("repo", "image repository or namespace that can be built").
+		StringsVar(&c.repos)
+
+	cmd.Flag("ping", "ping the docker daemon through the proxy socket and exit").
+		BoolVar(&c.ping)
+}
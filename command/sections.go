@@ -0,0 +1,59 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package command
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell"
+
+	"github.com/drone/runner-go/pipeline"
+)
+
+// sectionStreamer is a pipeline streamer that removes the
+// machine-readable section markers from the step logs, which
+// are not intended to be read in the console.
+type sectionStreamer struct {
+	base pipeline.Streamer
+}
+
+// Stream returns an io.WriteCloser that removes the section
+// markers from the step logs.
+func (s *sectionStreamer) Stream(ctx context.Context, state *pipeline.State, name string) io.WriteCloser {
+	return &sectionWriter{base: s.base.Stream(ctx, state, name)}
+}
+
+// sectionWriter buffers partial log lines, and removes the
+// section markers from complete log lines.
+type sectionWriter struct {
+	base io.WriteCloser
+	buf  bytes.Buffer
+}
+
+func (w *sectionWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i == -1 {
+			return len(b), nil
+		}
+		line := w.buf.Next(i + 1)
+		if shell.IsSection(string(line)) {
+			continue
+		}
+		if _, err := w.base.Write(line); err != nil {
+			return len(b), err
+		}
+	}
+}
+
+func (w *sectionWriter) Close() error {
+	if w.buf.Len() != 0 && !shell.IsSection(w.buf.String()) {
+		w.base.Write(w.buf.Bytes())
+	}
+	return w.base.Close()
+}
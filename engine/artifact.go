@@ -0,0 +1,160 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// helper function copies the step artifacts from the exited
+// container to the artifact directory, and returns the paths
+// of the exported files, relative to the artifact directory.
+func (e *Docker) export(ctx context.Context, step *Step, output io.Writer) []string {
+	if e.artifactDir == "" || step.Artifacts == nil {
+		return nil
+	}
+	// the directory is joined to the root path to prevent
+	// the directory from escaping the artifact root.
+	dir := filepath.Join(e.artifactDir, filepath.FromSlash(path.Join("/", step.Artifacts.Dir)))
+
+	var files []string
+	for _, pattern := range step.Artifacts.Paths {
+		exported, err := e.copyFrom(ctx, step.ID, pattern, step.Artifacts.Workspace, dir)
+		if err != nil {
+			fmt.Fprintf(output, "cannot export artifact %s: %s\n", pattern, err)
+			continue
+		}
+		if len(exported) == 0 {
+			fmt.Fprintf(output, "no artifacts found matching %s\n", pattern)
+			continue
+		}
+		files = append(files, exported...)
+	}
+	if len(files) != 0 {
+		fmt.Fprintf(output, "exported %d artifact(s) to %s\n", len(files), dir)
+	}
+	return files
+}
+
+// helper function emulates the `docker cp` command, copying
+// the container paths matching the pattern to the directory.
+func (e *Docker) copyFrom(ctx context.Context, id, pattern, workspace, dir string) ([]string, error) {
+	root := globRoot(pattern)
+	rc, _, err := e.client.CopyFromContainer(ctx, id, root)
+	if client.IsErrNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return extract(rc, path.Dir(root), pattern, workspace, dir)
+}
+
+// helper function extracts the tar archive entries matching
+// the pattern to the directory. The entry names are relative
+// to the parent directory in the container. Files inside the
+// workspace are extracted relative to the workspace, and all
+// other files are extracted relative to the container root.
+func extract(r io.Reader, parent, pattern, workspace, dir string) ([]string, error) {
+	var files []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		name := path.Join(parent, hdr.Name)
+		if !matchArtifact(pattern, name) {
+			continue
+		}
+		rel := strings.TrimPrefix(name, "/")
+		switch {
+		case workspace == "":
+		case name == workspace:
+			rel = "."
+		case strings.HasPrefix(name, workspace+"/"):
+			rel = strings.TrimPrefix(name, workspace+"/")
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return files, err
+			}
+		case tar.TypeReg:
+			if err := writeFile(target, tr, hdr.FileInfo().Mode().Perm()); err != nil {
+				return files, err
+			}
+			files = append(files, rel)
+		default:
+			// symbolic links and special files are not exported,
+			// since a link could reference a file on the host
+			// machine once extracted.
+		}
+	}
+}
+
+// helper function writes the file contents to the target
+// path, creating the parent directories if not exists.
+func writeFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// helper function returns true if the container path, or
+// any of its parent directories, match the pattern.
+func matchArtifact(pattern, name string) bool {
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		parent := path.Dir(name)
+		if parent == name {
+			return false
+		}
+		name = parent
+	}
+}
+
+// helper function returns the longest directory prefix of
+// the pattern that does not contain glob characters.
+func globRoot(pattern string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if strings.ContainsAny(part, "*?[\\") {
+			parts = parts[:i]
+			break
+		}
+	}
+	root := strings.Join(parts, "/")
+	if root == "" {
+		return "/"
+	}
+	return root
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExtract(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	entries := []struct {
+		name string
+		flag byte
+		body string
+	}{
+		{"dist/", tar.TypeDir, ""},
+		{"dist/app.tar.gz", tar.TypeReg, "app"},
+		{"dist/app.zip", tar.TypeReg, "zip"},
+		{"dist/link.tar.gz", tar.TypeSymlink, ""},
+	}
+	for _, entry := range entries {
+		tw.WriteHeader(&tar.Header{
+			Name:     entry.name,
+			Typeflag: entry.flag,
+			Linkname: "/etc/passwd",
+			Mode:     0644,
+			Size:     int64(len(entry.body)),
+		})
+		tw.Write([]byte(entry.body))
+	}
+	tw.Close()
+
+	dir, err := ioutil.TempDir("", "drone-artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	got, err := extract(buf, "/drone/src", "/drone/src/dist/*.tar.gz", "/drone/src", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"dist/app.tar.gz"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(diff)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dist", "app.tar.gz"))
+	if err != nil {
+		t.Error(err)
+	} else if string(data) != "app" {
+		t.Errorf("Want file contents app, got %s", data)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "dist", "link.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("Expect symbolic link is not extracted")
+	}
+}
+
+func TestMatchArtifact(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"/drone/src/coverage.out", "/drone/src/coverage.out", true},
+		{"/drone/src/dist", "/drone/src/dist/app", true},
+		{"/drone/src/dist/*.zip", "/drone/src/dist/app.zip", true},
+		{"/drone/src/dist/*", "/drone/src/dist/bin/app", true},
+		{"/drone/src/dist/*.zip", "/drone/src/dist/app.tar.gz", false},
+		{"/drone/src/dist", "/drone/src/distribution", false},
+	}
+	for _, test := range tests {
+		if got, want := matchArtifact(test.pattern, test.name), test.match; got != want {
+			t.Errorf("Want match %v for %s and %s", want, test.pattern, test.name)
+		}
+	}
+}
+
+func TestGlobRoot(t *testing.T) {
+	tests := []struct {
+		pattern string
+		root    string
+	}{
+		{"/drone/src/coverage.out", "/drone/src/coverage.out"},
+		{"/drone/src/dist/*.tar.gz", "/drone/src/dist"},
+		{"/drone/src/*/report.xml", "/drone/src"},
+		{"/*.log", "/"},
+	}
+	for _, test := range tests {
+		if got, want := globRoot(test.pattern), test.root; got != want {
+			t.Errorf("Want root %s for %s, got %s", want, test.pattern, got)
+		}
+	}
+}
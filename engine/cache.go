@@ -0,0 +1,349 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/drone-runners/drone-runner-docker/internal/docker/errors"
+	"github.com/drone/runner-go/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// labelCache is the volume label used to identify the
+	// cache volumes managed by the runner.
+	labelCache = "io.drone.cache"
+
+	// labelCacheKey is the volume label used to record the
+	// rendered cache key.
+	labelCacheKey = "io.drone.cache.key"
+)
+
+// cacheVolume tracks the volume a cache is restored from for
+// the duration of the pipeline.
+type cacheVolume struct {
+	sync chan struct{}
+
+	id      string
+	created bool
+	failed  bool
+	err     error
+}
+
+// helper function returns the named cache.
+func (s *Spec) lookupCache(name string) (*Cache, bool) {
+	for _, cache := range s.Caches {
+		if cache.Name == name {
+			return cache, true
+		}
+	}
+	return nil, false
+}
+
+// helper function returns the cache volume for the named
+// cache, and true if the caller is responsible for resolving
+// the volume. Other callers must wait for the volume to be
+// resolved before it is used.
+func (s *Spec) cacheVolume(name string) (*cacheVolume, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.caches == nil {
+		s.caches = map[string]*cacheVolume{}
+	}
+	if v, ok := s.caches[name]; ok {
+		return v, false
+	}
+	v := &cacheVolume{sync: make(chan struct{})}
+	s.caches[name] = v
+	return v, true
+}
+
+// helper function marks the caches mounted by the step as
+// failed, which prevents newly created caches from being
+// saved.
+func (s *Spec) failCaches(step *Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range step.Caches {
+		if v, ok := s.caches[name]; ok {
+			v.failed = true
+		}
+	}
+}
+
+// helper function returns the volume mounts for the caches
+// used by the step, restoring each cache from the volume that
+// matches the rendered key. If a cache cannot be restored the
+// step runs without the cache.
+func (e *Docker) restoreCaches(ctx context.Context, spec *Spec, step *Step, output io.Writer) []mount.Mount {
+	var mounts []mount.Mount
+	for _, name := range step.Caches {
+		cache, ok := spec.lookupCache(name)
+		if !ok {
+			continue
+		}
+		v, owner := spec.cacheVolume(name)
+		if owner {
+			v.id, v.created, v.err = e.createCache(ctx, spec, step, cache, output)
+			close(v.sync)
+		} else {
+			select {
+			case <-v.sync:
+			case <-ctx.Done():
+				return mounts
+			}
+		}
+		if v.err != nil {
+			fmt.Fprintf(output, "cannot restore cache %s: %s\n", name, v.err)
+			continue
+		}
+		// an existing cache is mounted read-only, which
+		// prevents a build from modifying the cache that is
+		// restored by other builds. A cache is only writable
+		// when newly created, in which case the volume is
+		// removed if the step fails.
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   v.id,
+			Target:   cache.Path,
+			ReadOnly: !v.created,
+		})
+	}
+	return mounts
+}
+
+// helper function renders the cache key and returns the cache
+// volume for the key, creating the volume if not exists.
+func (e *Docker) createCache(ctx context.Context, spec *Spec, step *Step, cache *Cache, output io.Writer) (string, bool, error) {
+	key, err := renderKey(cache.Key, func(name string) (string, error) {
+		return e.checksum(ctx, spec, step, path.Join(cache.Workspace, name), output)
+	})
+	if err != nil {
+		return "", false, err
+	}
+	id := cacheVolumeName(cache.Scope, cache.Name, key)
+
+	_, err = e.client.VolumeInspect(ctx, id)
+	if err == nil {
+		fmt.Fprintf(output, "restoring cache %s from key %s\n", cache.Name, key)
+		return id, false, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return "", false, errors.TrimExtraInfo(err)
+	}
+
+	fmt.Fprintf(output, "no cache %s found for key %s, creating cache\n", cache.Name, key)
+	_, err = e.client.VolumeCreate(ctx, volume.VolumeCreateBody{
+		Name:   id,
+		Driver: "local",
+		Labels: map[string]string{
+			labelCache:    cache.Name,
+			labelCacheKey: key,
+		},
+	})
+	if err != nil {
+		return "", false, errors.TrimExtraInfo(err)
+	}
+	return id, true, nil
+}
+
+// helper function returns the sha256 checksum of the file in
+// the workspace. The file is read from a container that mounts
+// the step volumes, which is created but never started.
+func (e *Docker) checksum(ctx context.Context, spec *Spec, step *Step, name string, output io.Writer) (string, error) {
+	config := &container.Config{
+		Image:  step.Image,
+		Labels: step.Labels,
+	}
+	hostConfig := toHostConfig(spec, step)
+	created, err := e.client.ContainerCreate(ctx, config, hostConfig, nil, "")
+	if client.IsErrNotFound(err) && step.Pull != PullNever {
+		if err := e.pull(ctx, step.Image, step.Auth, output); err != nil {
+			return "", err
+		}
+		created, err = e.client.ContainerCreate(ctx, config, hostConfig, nil, "")
+	}
+	if err != nil {
+		return "", errors.TrimExtraInfo(err)
+	}
+	defer e.remove(ctx, created.ID)
+
+	rc, _, err := e.client.CopyFromContainer(ctx, created.ID, name)
+	if err != nil {
+		return "", errors.TrimExtraInfo(err)
+	}
+	defer rc.Close()
+	return checksumFile(rc)
+}
+
+// helper function returns the sha256 checksum of the first
+// file in the tar archive.
+func checksumFile(r io.Reader) (string, error) {
+	tr := tar.NewReader(r)
+	hdr, err := tr.Next()
+	if err != nil {
+		return "", err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return "", fmt.Errorf("cannot checksum %s: not a regular file", hdr.Name)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, tr); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// helper function renders the cache key template.
+func renderKey(key string, checksum func(string) (string, error)) (string, error) {
+	t, err := template.New("_").Funcs(template.FuncMap{
+		"checksum": checksum,
+	}).Parse(key)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := t.Execute(buf, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// helper function returns the cache volume name. The name is
+// derived from the scope, which prevents a repository, branch
+// or trust level from restoring the cache of another.
+func cacheVolumeName(scope, name, key string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s", scope, name, key)
+	return fmt.Sprintf("drone-cache-%x", h.Sum(nil))
+}
+
+// helper function saves the caches used by the pipeline. A
+// newly created cache is removed if a step that mounts the
+// cache failed, otherwise the cache is recorded as used and
+// the least recently used caches are evicted.
+func (e *Docker) saveCaches(ctx context.Context, spec *Spec) {
+	spec.mu.Lock()
+	caches := spec.caches
+	spec.mu.Unlock()
+	if len(caches) == 0 {
+		return
+	}
+
+	for name, v := range caches {
+		select {
+		case <-v.sync:
+		default:
+			// the cache is still being resolved, which only
+			// happens if the pipeline is cancelled.
+			continue
+		}
+		if v.err != nil {
+			continue
+		}
+		spec.mu.Lock()
+		failed := v.failed
+		spec.mu.Unlock()
+		if failed && v.created {
+			if err := e.client.VolumeRemove(ctx, v.id, false); err != nil {
+				logger.FromContext(ctx).
+					WithError(err).
+					WithField("cache", name).
+					WithField("volume", v.id).
+					Debugln("cannot remove cache volume")
+			}
+			continue
+		}
+		e.caches.Put(v.id, time.Now())
+	}
+
+	if e.cacheMaxSize > 0 {
+		e.evictCaches(ctx)
+	}
+}
+
+// helper function evicts the least recently used caches until
+// the total size of the caches is below the maximum size.
+func (e *Docker) evictCaches(ctx context.Context) {
+	usage, err := e.client.DiskUsage(ctx)
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			Debugln("cannot list cache volumes")
+		return
+	}
+	lastUsed := func(v *types.Volume) time.Time {
+		if t, ok := e.caches.Get(v.Name); ok {
+			return t
+		}
+		t, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		return t
+	}
+	for _, v := range selectEvictions(usage.Volumes, lastUsed, e.cacheMaxSize) {
+		if err := e.client.VolumeRemove(ctx, v.Name, false); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("volume", v.Name).
+				Debugln("cannot evict cache volume")
+			continue
+		}
+		e.caches.Delete(v.Name)
+		logger.FromContext(ctx).
+			WithField("cache", v.Labels[labelCache]).
+			WithField("volume", v.Name).
+			WithField("size", v.UsageData.Size).
+			Debugln("evicted cache volume")
+	}
+}
+
+// helper function returns the cache volumes that must be
+// evicted, least recently used first, so that the total size
+// of the caches does not exceed the maximum size. Volumes that
+// are in use are never evicted.
+func selectEvictions(volumes []*types.Volume, lastUsed func(*types.Volume) time.Time, max int64) []*types.Volume {
+	var caches []*types.Volume
+	var total int64
+	for _, v := range volumes {
+		if _, ok := v.Labels[labelCache]; !ok {
+			continue
+		}
+		if v.UsageData == nil || v.UsageData.Size < 0 {
+			continue
+		}
+		caches = append(caches, v)
+		total += v.UsageData.Size
+	}
+	sort.SliceStable(caches, func(i, j int) bool {
+		return lastUsed(caches[i]).Before(lastUsed(caches[j]))
+	})
+
+	var evict []*types.Volume
+	for _, v := range caches {
+		if total <= max {
+			break
+		}
+		if v.UsageData.RefCount > 0 {
+			continue
+		}
+		evict = append(evict, v)
+		total -= v.UsageData.Size
+	}
+	return evict
+}
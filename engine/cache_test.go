@@ -0,0 +1,143 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestRenderKey(t *testing.T) {
+	checksum := func(name string) (string, error) {
+		return "checksum-of-" + name, nil
+	}
+	got, err := renderKey(`go-{{ checksum "go.sum" }}`, checksum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "go-checksum-of-go.sum"; got != want {
+		t.Errorf("Want key %s, got %s", want, got)
+	}
+}
+
+func TestCacheVolumeName(t *testing.T) {
+	a := cacheVolumeName("octocat/hello-world", "go", "go-1")
+	b := cacheVolumeName("octocat/hello-world", "go", "go-1")
+	if a != b {
+		t.Errorf("Expect volume name is deterministic")
+	}
+	if a == cacheVolumeName("octocat/spoon-knife", "go", "go-1") {
+		t.Errorf("Expect volume name is scoped to the repository")
+	}
+	if a == cacheVolumeName("octocat/hello-world", "go", "go-2") {
+		t.Errorf("Expect volume name is derived from the key")
+	}
+}
+
+// This test verifies that a read-only cache is mounted
+// read-only when restored, and writable when created.
+func TestRestoreCaches_ReadOnly(t *testing.T) {
+	cache := &Cache{Name: "go", Path: "/go/pkg/mod", Key: "go", Scope: "octocat/hello-world:trusted:master"}
+	step := &Step{Name: "test", Caches: []string{"go"}}
+
+	client := new(fakeClient)
+	engine := &Docker{client: client}
+	mounts := engine.restoreCaches(context.Background(), &Spec{Caches: []*Cache{cache}}, step, ioutil.Discard)
+	if len(mounts) != 1 {
+		t.Fatalf("Want cache mounted, got %d mounts", len(mounts))
+	}
+	if mounts[0].ReadOnly {
+		t.Errorf("Want newly created cache mounted writable")
+	}
+
+	mounts = engine.restoreCaches(context.Background(), &Spec{Caches: []*Cache{cache}}, step, ioutil.Discard)
+	if len(mounts) != 1 {
+		t.Fatalf("Want cache mounted, got %d mounts", len(mounts))
+	}
+	if !mounts[0].ReadOnly {
+		t.Errorf("Want restored cache mounted read-only")
+	}
+}
+
+func TestChecksumFile(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{
+		Name:     "go.sum",
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     5,
+	})
+	tw.Write([]byte("hello"))
+	tw.Close()
+
+	got, err := checksumFile(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if got != want {
+		t.Errorf("Want checksum %s, got %s", want, got)
+	}
+}
+
+func TestSelectEvictions(t *testing.T) {
+	now := time.Now()
+	volumes := []*types.Volume{
+		{
+			Name:      "recent",
+			Labels:    map[string]string{labelCache: "go"},
+			UsageData: &types.VolumeUsageData{Size: 100},
+		},
+		{
+			Name:      "oldest",
+			Labels:    map[string]string{labelCache: "go"},
+			UsageData: &types.VolumeUsageData{Size: 100},
+		},
+		{
+			Name:      "in-use",
+			Labels:    map[string]string{labelCache: "npm"},
+			UsageData: &types.VolumeUsageData{Size: 100, RefCount: 1},
+		},
+		{
+			Name:      "older",
+			Labels:    map[string]string{labelCache: "npm"},
+			UsageData: &types.VolumeUsageData{Size: 100},
+		},
+		{
+			Name:      "not-a-cache",
+			UsageData: &types.VolumeUsageData{Size: 1000},
+		},
+	}
+	lastUsed := func(v *types.Volume) time.Time {
+		switch v.Name {
+		case "oldest":
+			return now.Add(-time.Hour * 3)
+		case "in-use":
+			return now.Add(-time.Hour * 4)
+		case "older":
+			return now.Add(-time.Hour * 2)
+		default:
+			return now
+		}
+	}
+
+	evict := selectEvictions(volumes, lastUsed, 200)
+	if len(evict) != 2 {
+		t.Fatalf("Want 2 evictions, got %d", len(evict))
+	}
+	if got, want := evict[0].Name, "oldest"; got != want {
+		t.Errorf("Want evicted volume %s, got %s", want, got)
+	}
+	if got, want := evict[1].Name, "older"; got != want {
+		t.Errorf("Want evicted volume %s, got %s", want, got)
+	}
+}
@@ -55,3 +55,41 @@ func createClone(src *resource.Pipeline) *engine.Step {
 		Envs:      cloneParams(src.Clone),
 	}
 }
+
+// helper function creates the internal diff step, which lists
+// the files changed by the build in the cloned repository. The
+// diff step uses the clone image, workspace and security
+// profile.
+func createDiff(clone *engine.Step) *engine.Step {
+	return &engine.Step{
+		Image:       clone.Image,
+		Auth:        clone.Auth,
+		Pull:        clone.Pull,
+		Runtime:     clone.Runtime,
+		Labels:      clone.Labels,
+		CapDrop:     clone.CapDrop,
+		CapAdd:      clone.CapAdd,
+		NoNewPrivs:  clone.NoNewPrivs,
+		SecurityOpt: clone.SecurityOpt,
+		PidsLimit:   clone.PidsLimit,
+		Entrypoint:  []string{"/bin/sh", "-c"},
+		Command:     []string{diffScript},
+		Output:      diffOutput,
+		Network:     "none",
+		Volumes:     clone.Volumes,
+		WorkingDir:  clone.WorkingDir,
+		Envs: map[string]string{
+			"DRONE_COMMIT_BEFORE": clone.Envs["DRONE_COMMIT_BEFORE"],
+			"DRONE_COMMIT_AFTER":  clone.Envs["DRONE_COMMIT_AFTER"],
+		},
+	}
+}
+
+// diffOutput is the path of the file the diff step writes the
+// list of changed files to.
+const diffOutput = "/tmp/drone_changes"
+
+// diffScript lists the files changed between the before and
+// after commits. The workspace may be owned by another user
+// if the repository is mounted from the host machine.
+const diffScript = `git -c safe.directory='*' diff --name-only "$DRONE_COMMIT_BEFORE" "$DRONE_COMMIT_AFTER" > ` + diffOutput
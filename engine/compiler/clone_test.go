@@ -152,3 +152,27 @@ func TestCloneParams(t *testing.T) {
 		t.Errorf("Expect PLUGIN_SKIP_VERIFY is true")
 	}
 }
+
+// This test verifies that the diff step inherits the security
+// profile of the clone step.
+func TestCreateDiff(t *testing.T) {
+	clone := &engine.Step{
+		Image:       "drone/git",
+		CapAdd:      []string{"CHOWN"},
+		CapDrop:     []string{"ALL"},
+		NoNewPrivs:  true,
+		SecurityOpt: []string{"seccomp=profile.json"},
+		PidsLimit:   256,
+		Envs:        map[string]string{},
+	}
+	diff := createDiff(clone)
+	if diff.Image != clone.Image {
+		t.Errorf("Want diff image %q, got %q", clone.Image, diff.Image)
+	}
+	if !cmp.Equal(diff.CapDrop, clone.CapDrop) || !cmp.Equal(diff.CapAdd, clone.CapAdd) {
+		t.Errorf("Expect diff step capabilities copied from the clone step")
+	}
+	if !diff.NoNewPrivs || diff.PidsLimit != 256 || !cmp.Equal(diff.SecurityOpt, clone.SecurityOpt) {
+		t.Errorf("Expect diff step security options copied from the clone step")
+	}
+}
@@ -6,8 +6,11 @@ package compiler
 
 import (
 	"context"
+	"fmt"
 	"os"
+	stdpath "path"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
@@ -55,6 +58,12 @@ type Resources struct {
 	CPUShares  int64
 	CPUSet     []string
 	ShmSize    int64
+
+	// PidsLimit and Ulimits are applied to steps that do
+	// not define limits, and are the maximum limits for
+	// untrusted repositories.
+	PidsLimit int64
+	Ulimits   []*engine.Ulimit
 }
 
 // Tmate defines tmate settings.
@@ -68,6 +77,29 @@ type Tmate struct {
 	AuthorizedKeys string
 }
 
+// DockerProxy defines the docker socket proxy settings.
+type DockerProxy struct {
+	Enabled bool
+	Image   string
+}
+
+// Hardening defines the restrictive container profile that
+// is applied to the steps and services of untrusted
+// repositories. Hardened steps never run in privileged mode.
+type Hardening struct {
+	Enabled bool
+
+	// CapAdd provides the allowlist of capabilities that
+	// are retained. All other capabilities are dropped.
+	CapAdd []string
+
+	// PidsLimit provides the maximum number of processes.
+	PidsLimit int64
+
+	// Seccomp provides the seccomp profile json.
+	Seccomp string
+}
+
 // Compiler compiles the Yaml configuration file to an
 // intermediate representation optimized for simple execution.
 type Compiler struct {
@@ -111,6 +143,15 @@ type Compiler struct {
 	// live debugging.
 	Tmate Tmate
 
+	// DockerProxy provides the docker socket proxy settings.
+	// The proxy permits steps to build and push images
+	// without privileged mode or raw socket access.
+	DockerProxy DockerProxy
+
+	// Hardening provides the restrictive container profile
+	// applied to untrusted repositories.
+	Hardening Hardening
+
 	// Secret returns a named secret value that can be injected
 	// into the pipeline step.
 	Secret secret.Provider
@@ -122,6 +163,31 @@ type Compiler struct {
 	// Mount is an optional field that overrides the default
 	// workspace volume and mounts to the host path
 	Mount string
+
+	// PullPolicy provides the default image pull policy for
+	// steps that do not define a pull policy.
+	PullPolicy string
+
+	// StopSignal provides the default signal sent to stop
+	// containers that do not define a stop signal, when the
+	// pipeline is cancelled or times out.
+	StopSignal string
+
+	// StopGrace provides the default grace period given to
+	// containers to exit after the stop signal, before the
+	// container is killed.
+	StopGrace time.Duration
+
+	// Runtime provides the default container runtime for
+	// trusted repositories. If empty, the default runtime
+	// configured for the Docker daemon is used.
+	Runtime string
+
+	// RuntimeUntrusted provides the container runtime for
+	// untrusted repositories, such as a sandboxed runtime
+	// (e.g. runsc). The runtime cannot be overridden by
+	// untrusted repositories.
+	RuntimeUntrusted string
 }
 
 // Compile compiles the configuration file.
@@ -305,6 +371,8 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 	}
 
 	// create steps
+	var proxied []*engine.Step
+	var repos []string
 	for _, src := range pipeline.Services {
 		dst := createStep(pipeline, src)
 		dst.Detach = true
@@ -324,16 +392,39 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		if c.isPrivileged(src) {
 			dst.Privileged = true
 		}
+		if c.DockerProxy.Enabled && src.DockerProxy {
+			proxied = append(proxied, dst)
+			repos = append(repos, proxyRepos(src)...)
+		}
 	}
 
-	// create steps
-	for _, src := range pipeline.Steps {
+	// create the build caches, which are scoped to the
+	// repository, trust level and branch and mounted into
+	// each pipeline step.
+	for _, src := range pipeline.Cache {
+		spec.Caches = append(spec.Caches, &engine.Cache{
+			Name:      src.Name,
+			Path:      src.Path,
+			Key:       src.Key,
+			Scope:     cacheScope(args.Repo, args.Build),
+			Workspace: full,
+		})
+	}
+
+	// create steps. Steps that define a matrix are expanded
+	// into one step per combination of matrix values.
+	for _, src := range expandMatrix(pipeline.Steps) {
 		dst := createStep(pipeline, src)
 		dst.Envs = environ.Combine(envs, dst.Envs)
 		dst.Volumes = append(dst.Volumes, mount)
 		dst.Labels = stageLabels
+		for _, cache := range spec.Caches {
+			dst.Caches = append(dst.Caches, cache.Name)
+		}
 		setupScript(src, dst, os)
 		setupWorkdir(src, dst, full)
+		setupOutput(dst, base, os)
+		setupEnvFile(dst, base, os)
 		spec.Steps = append(spec.Steps, dst)
 
 		// if the pipeline step has unmet conditions the step is
@@ -348,6 +439,75 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		if c.isPrivileged(src) {
 			dst.Privileged = true
 		}
+
+		// if the pipeline step uses the docker socket proxy,
+		// the proxy socket is mounted into the step.
+		if c.DockerProxy.Enabled && src.DockerProxy {
+			proxied = append(proxied, dst)
+			repos = append(repos, proxyRepos(src)...)
+		}
+	}
+
+	// create the internal docker socket proxy step if any
+	// steps use the docker socket proxy. The proxy only
+	// permits access to images built by this stage, which
+	// are identified by a random label value, and only
+	// permits images to be built in the repository namespace
+	// or the repositories declared in the step settings.
+	if len(proxied) != 0 && pipeline.Platform.OS != "windows" {
+		value := random()
+		command := []string{"proxy", "--label", engine.LabelProxy + "=" + value}
+		if args.Repo.Namespace != "" {
+			command = append(command, "--repo", args.Repo.Namespace+"/")
+		}
+		for _, repo := range repos {
+			command = append(command, "--repo", repo)
+		}
+		spec.Internal = append(spec.Internal, &engine.Step{
+			ID: random(),
+			Labels: labels.Combine(stageLabels, map[string]string{
+				engine.LabelProxy: value,
+			}),
+			Pull:       engine.PullIfNotExists,
+			Image:      image.Expand(c.DockerProxy.Image),
+			Entrypoint: []string{"/bin/drone-runner-docker"},
+			Command:    command,
+			Detach:     true,
+			Network:    "none",
+			// the proxy must be listening before the steps
+			// that use the proxy socket are started.
+			Ready: &engine.Ready{
+				Command: []string{"/bin/drone-runner-docker", "proxy", "--ping"},
+			},
+			Volumes: []*engine.VolumeMount{
+				{Name: "_docker_socket", Path: "/var/run/docker.sock"},
+				{Name: "_docker_proxy", Path: "/run/drone"},
+			},
+		})
+		for _, step := range proxied {
+			step.Envs["DOCKER_HOST"] = "unix:///run/drone/docker.sock"
+			step.Volumes = append(step.Volumes, &engine.VolumeMount{
+				Name: "_docker_proxy",
+				Path: "/run/drone",
+			})
+		}
+		spec.Volumes = append(spec.Volumes,
+			&engine.Volume{
+				HostPath: &engine.VolumeHostPath{
+					ID:     random(),
+					Name:   "_docker_socket",
+					Path:   "/var/run/docker.sock",
+					Labels: stageLabels,
+				},
+			},
+			&engine.Volume{
+				EmptyDir: &engine.VolumeEmptyDir{
+					ID:     random(),
+					Name:   "_docker_proxy",
+					Labels: stageLabels,
+				},
+			},
+		)
 	}
 
 	// create internal steps if build running in debug mode
@@ -480,6 +640,65 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		step.CPUQuota = c.Resources.CPUQuota
 		step.CPUShares = c.Resources.CPUShares
 		step.CPUSet = c.Resources.CPUSet
+
+		// the process and file limits defined in the yaml
+		// take precedence over global values, however,
+		// untrusted repositories cannot exceed the global
+		// values.
+		step.PidsLimit = applyLimit(step.PidsLimit, c.Resources.PidsLimit, args.Repo.Trusted)
+		step.Ulimits = applyUlimits(step.Ulimits, c.Resources.Ulimits, args.Repo.Trusted)
+	}
+
+	// append the default pull policy to steps that do not
+	// define a pull policy.
+	if c.PullPolicy != "" {
+		policy, maxAge := convertPullPolicy(c.PullPolicy)
+		for _, step := range spec.Steps {
+			if step.Pull == engine.PullDefault {
+				step.Pull = policy
+				step.PullMaxAge = maxAge
+			}
+		}
+	}
+
+	// append the default stop signal and grace period to
+	// steps that do not define a stop signal or grace period.
+	for _, step := range spec.Steps {
+		if step.StopSignal == "" {
+			step.StopSignal = c.StopSignal
+		}
+		if step.StopGrace == 0 {
+			step.StopGrace = c.StopGrace
+		}
+	}
+
+	// apply the hardened profile to the steps of untrusted
+	// repositories. trusted repositories are not modified.
+	if c.Hardening.Enabled && !args.Repo.Trusted {
+		for _, step := range spec.Steps {
+			applyHardening(step, c.Hardening)
+		}
+	}
+
+	// append the container runtime to the steps. trusted
+	// repositories can override the default runtime, however,
+	// untrusted repositories always use the untrusted runtime.
+	for _, step := range spec.Steps {
+		switch {
+		case !args.Repo.Trusted:
+			step.Runtime = c.RuntimeUntrusted
+		case step.Runtime == "":
+			step.Runtime = c.Runtime
+		}
+	}
+
+	// create the internal diff step if any steps define path
+	// conditions. The diff step uses the clone image and runs
+	// after the clone step to list the files changed by the
+	// build.
+	if hasPaths(spec) && pipeline.Clone.Disable == false && os != "windows" {
+		spec.Diff = createDiff(spec.Steps[0])
+		spec.Diff.ID = random()
 	}
 
 	// append global networks to the steps.
@@ -492,6 +711,18 @@ func (c *Compiler) Compile(ctx context.Context, args runtime.CompilerArgs) runti
 		}))
 	}
 
+	// resolve the step artifacts. the artifacts are exported
+	// to a directory laid out by repository, build, stage
+	// and step.
+	for _, step := range spec.Steps {
+		setupArtifacts(step, full, stdpath.Join(
+			args.Repo.Slug,
+			fmt.Sprint(args.Build.Number),
+			fmt.Sprint(args.Stage.Number),
+			step.Name,
+		))
+	}
+
 	// append global volumes to the steps.
 	for k, v := range c.Volumes {
 		id := random()
@@ -581,6 +812,11 @@ func (c *Compiler) isPrivileged(step *resource.Step) bool {
 	if isRestrictedVariable(step.Environment) {
 		return false
 	}
+	// privileged-by-default mode is disabled if the
+	// pipeline step uses the docker socket proxy.
+	if c.DockerProxy.Enabled && step.DockerProxy {
+		return false
+	}
 	// if the container image matches any image
 	// in the whitelist, return true.
 	for _, img := range c.Privileged {
@@ -11,6 +11,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
 	"github.com/drone/drone-go/drone"
+	"github.com/drone/envsubst"
 	"github.com/drone/runner-go/environ/provider"
 	"github.com/drone/runner-go/manifest"
 	"github.com/drone/runner-go/pipeline/runtime"
@@ -50,6 +52,42 @@ func TestCompile_Graph(t *testing.T) {
 	testCompile(t, "testdata/graph.yml", "testdata/graph.json")
 }
 
+// This test verifies that steps defining a matrix are expanded
+// into one step per combination, and that dependent steps
+// depend on every combination.
+func TestCompile_Matrix(t *testing.T) {
+	testCompile(t, "testdata/matrix.yml", "testdata/matrix.json")
+}
+
+// This test verifies that the matrix placeholders are not
+// substituted by envsubst, which is applied to the yaml
+// configuration before it is compiled.
+func TestCompile_Matrix_Envsubst(t *testing.T) {
+	raw, err := ioutil.ReadFile("testdata/matrix.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := envsubst.Eval(string(raw), func(string) string { return "" })
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(t.TempDir(), "matrix.yml")
+	if err := ioutil.WriteFile(source, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	testCompile(t, source, "testdata/matrix.json")
+}
+
+// This test verifies that path conditions are converted to
+// step path conditions, and that the internal diff step is
+// created to list the changed files.
+func TestCompile_Paths(t *testing.T) {
+	ir := testCompile(t, "testdata/paths.yml", "testdata/paths.json")
+	if got, want := ir.Diff.Envs["DRONE_COMMIT_AFTER"], ir.Steps[0].Envs["DRONE_COMMIT_AFTER"]; got != want {
+		t.Errorf("Want diff commit %q, got %q", want, got)
+	}
+}
+
 // This test verifies no clone step exists in the pipeline if
 // cloning is disabled.
 func TestCompile_CloneDisabled_Serial(t *testing.T) {
@@ -93,6 +131,57 @@ func TestCompile_RunFailure(t *testing.T) {
 	}
 }
 
+// This test verifies that the step retry policy is copied
+// to the intermediate representation.
+func TestCompile_Retry(t *testing.T) {
+	ir := testCompile(t, "testdata/retry.yml", "testdata/retry.json")
+	if ir.Steps[0].Retry == nil {
+		t.Errorf("Expect retry policy")
+	}
+}
+
+// This test verifies that the step artifacts are resolved
+// relative to the workspace.
+func TestCompile_Artifacts(t *testing.T) {
+	ir := testCompile(t, "testdata/artifacts.yml", "testdata/artifacts.json")
+	if ir.Steps[0].Artifacts == nil {
+		t.Errorf("Expect step artifacts")
+	}
+}
+
+// This test verifies that the build caches are copied to
+// the intermediate representation and mounted into steps.
+func TestCompile_Cache(t *testing.T) {
+	ir := testCompile(t, "testdata/cache.yml", "testdata/cache.json")
+	if len(ir.Steps[0].Caches) == 0 {
+		t.Errorf("Expect step caches")
+	}
+}
+
+// This test verifies that the step stop signal and grace
+// period are copied to the intermediate representation.
+func TestCompile_Stop(t *testing.T) {
+	ir := testCompile(t, "testdata/stop.yml", "testdata/stop.json")
+	if ir.Steps[0].StopSignal == "" {
+		t.Errorf("Expect stop signal")
+	}
+}
+
+// This test verifies that the step process, file and ulimit
+// constraints are copied to the intermediate representation.
+func TestCompile_Limits(t *testing.T) {
+	testCompile(t, "testdata/limits.yml", "testdata/limits.json")
+}
+
+// This test verifies that the step security options are
+// copied to the intermediate representation.
+func TestCompile_Security(t *testing.T) {
+	ir := testCompile(t, "testdata/security.yml", "testdata/security.json")
+	if !ir.Steps[0].ReadOnly {
+		t.Errorf("Expect read-only root filesystem")
+	}
+}
+
 // This test verifies that secrets defined in the yaml are
 // requested and stored in the intermediate representation
 // at compile time.
@@ -142,6 +231,186 @@ func TestCompile_Secrets(t *testing.T) {
 	}
 }
 
+// This test verifies that the container runtime is selected
+// based on the repository trust level.
+func TestCompile_Runtime(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/runtime.yml")
+
+	compiler := &Compiler{
+		Environ:          provider.Static(nil),
+		Registry:         registry.Static(nil),
+		Secret:           secret.Static(nil),
+		Runtime:          "runc",
+		RuntimeUntrusted: "runsc",
+	}
+	tests := []struct {
+		trusted bool
+		want    []string
+	}{
+		{trusted: true, want: []string{"runc", "kata-runtime"}},
+		{trusted: false, want: []string{"runsc", "runsc"}},
+	}
+	for _, test := range tests {
+		args := runtime.CompilerArgs{
+			Repo:     &drone.Repo{Trusted: test.trusted},
+			Build:    &drone.Build{},
+			Stage:    &drone.Stage{},
+			System:   &drone.System{},
+			Netrc:    &drone.Netrc{},
+			Manifest: manifest,
+			Pipeline: manifest.Resources[0].(*resource.Pipeline),
+			Secret:   secret.Static(nil),
+		}
+		ir := compiler.Compile(nocontext, args).(*engine.Spec)
+
+		var got []string
+		for _, step := range ir.Steps {
+			got = append(got, step.Runtime)
+		}
+		if diff := cmp.Diff(got, test.want); len(diff) != 0 {
+			t.Errorf(diff)
+		}
+	}
+}
+
+// This test verifies that the hardened profile is applied to
+// untrusted repositories only.
+func TestCompile_Hardening(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/runtime.yml")
+
+	compiler := &Compiler{
+		Environ:  provider.Static(nil),
+		Registry: registry.Static(nil),
+		Secret:   secret.Static(nil),
+		Hardening: Hardening{
+			Enabled:   true,
+			CapAdd:    []string{"CHOWN"},
+			PidsLimit: 256,
+		},
+	}
+	for _, trusted := range []bool{true, false} {
+		args := runtime.CompilerArgs{
+			Repo:     &drone.Repo{Trusted: trusted},
+			Build:    &drone.Build{},
+			Stage:    &drone.Stage{},
+			System:   &drone.System{},
+			Netrc:    &drone.Netrc{},
+			Manifest: manifest,
+			Pipeline: manifest.Resources[0].(*resource.Pipeline),
+			Secret:   secret.Static(nil),
+		}
+		ir := compiler.Compile(nocontext, args).(*engine.Spec)
+		for _, step := range ir.Steps {
+			if got, want := step.NoNewPrivs, !trusted; got != want {
+				t.Errorf("Want no-new-privileges %v for trusted %v, got %v", want, trusted, got)
+			}
+			if !trusted && step.PidsLimit != 256 {
+				t.Errorf("Want pids limit 256, got %d", step.PidsLimit)
+			}
+			if trusted && len(step.CapDrop) != 0 {
+				t.Errorf("Expect capabilities not dropped for trusted repositories")
+			}
+		}
+	}
+}
+
+// This test verifies that the hardened profile prevents the
+// privileged-by-default plugins from escalating privileges in
+// untrusted repositories.
+func TestCompile_Hardening_Privileged(t *testing.T) {
+	manifest, _ := manifest.ParseFile("testdata/hardening.yml")
+
+	compiler := &Compiler{
+		Environ:    provider.Static(nil),
+		Registry:   registry.Static(nil),
+		Secret:     secret.Static(nil),
+		Privileged: Privileged,
+		Hardening: Hardening{
+			Enabled: true,
+		},
+	}
+	for _, trusted := range []bool{true, false} {
+		args := runtime.CompilerArgs{
+			Repo:     &drone.Repo{Trusted: trusted},
+			Build:    &drone.Build{},
+			Stage:    &drone.Stage{},
+			System:   &drone.System{},
+			Netrc:    &drone.Netrc{},
+			Manifest: manifest,
+			Pipeline: manifest.Resources[0].(*resource.Pipeline),
+			Secret:   secret.Static(nil),
+		}
+		ir := compiler.Compile(nocontext, args).(*engine.Spec)
+		if got, want := ir.Steps[0].Privileged, trusted; got != want {
+			t.Errorf("Want privileged %v for trusted %v, got %v", want, trusted, got)
+		}
+	}
+}
+
+// This test verifies that the docker socket proxy is created
+// as an internal step, and is mounted into opted-in steps
+// instead of escalating privileges.
+func TestCompile_DockerProxy(t *testing.T) {
+	random = notRandom
+	defer func() {
+		random = uniuri.New
+	}()
+
+	manifest, _ := manifest.ParseFile("testdata/docker_proxy.yml")
+
+	compiler := &Compiler{
+		Environ:    provider.Static(nil),
+		Registry:   registry.Static(nil),
+		Secret:     secret.Static(nil),
+		Privileged: Privileged,
+		DockerProxy: DockerProxy{
+			Enabled: true,
+			Image:   "drone/drone-runner-docker:1",
+		},
+	}
+	args := runtime.CompilerArgs{
+		Repo:     &drone.Repo{Namespace: "octocat"},
+		Build:    &drone.Build{},
+		Stage:    &drone.Stage{},
+		System:   &drone.System{},
+		Netrc:    &drone.Netrc{},
+		Manifest: manifest,
+		Pipeline: manifest.Resources[0].(*resource.Pipeline),
+		Secret:   secret.Static(nil),
+	}
+	ir := compiler.Compile(nocontext, args).(*engine.Spec)
+
+	if len(ir.Internal) != 1 {
+		t.Fatalf("Expect docker socket proxy step")
+	}
+	want := []string{
+		"proxy",
+		"--label", "io.drone.proxy=random",
+		"--repo", "octocat/",
+		"--repo", "octocat/hello-world",
+	}
+	if got := ir.Internal[0].Command; !cmp.Equal(got, want) {
+		t.Errorf("Want proxy command %v, got %v", want, got)
+	}
+	if got, want := ir.Internal[0].Labels[engine.LabelProxy], "random"; got != want {
+		t.Errorf("Want proxy label %q, got %q", want, got)
+	}
+	if ready := ir.Internal[0].Ready; ready == nil || !cmp.Equal(ready.Command, []string{"/bin/drone-runner-docker", "proxy", "--ping"}) {
+		t.Errorf("Expect proxy readiness probe pings the proxy socket, got %v", ready)
+	}
+
+	publish, test := ir.Steps[0], ir.Steps[1]
+	if publish.Privileged {
+		t.Errorf("Expect proxied step is not privileged")
+	}
+	if got, want := publish.Envs["DOCKER_HOST"], "unix:///run/drone/docker.sock"; got != want {
+		t.Errorf("Want DOCKER_HOST %q, got %q", want, got)
+	}
+	if _, ok := test.Envs["DOCKER_HOST"]; ok {
+		t.Errorf("Expect proxy socket is only mounted into opted-in steps")
+	}
+}
+
 // This test verifies that step labels are generated correctly
 func TestCompile_StepLabels(t *testing.T) {
 	manifest, _ := manifest.ParseFile("testdata/steps.yml")
@@ -0,0 +1,137 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-docker/engine/resource"
+
+	"github.com/drone/runner-go/manifest"
+)
+
+// matrixRE matches the matrix value placeholders in a step
+// (eg. "{{ matrix.go }}"). The placeholders are not expanded by
+// envsubst, which is applied to the configuration before it is
+// compiled.
+var matrixRE = regexp.MustCompile(`{{\s*matrix\.([a-zA-Z0-9_]+)\s*}}`)
+
+// helper function expands the steps that define a matrix into
+// one step per combination of matrix values. Steps that depend
+// on a matrix step are updated to depend on every combination.
+func expandMatrix(steps []*resource.Step) []*resource.Step {
+	var expanded []*resource.Step
+	names := map[string][]string{}
+	for _, step := range steps {
+		if len(step.Matrix) == 0 {
+			expanded = append(expanded, step)
+			continue
+		}
+		for _, axis := range matrixAxes(step.Matrix) {
+			dst := expandStep(step, axis)
+			names[step.Name] = append(names[step.Name], dst.Name)
+			expanded = append(expanded, dst)
+		}
+	}
+	if len(names) == 0 {
+		return steps
+	}
+
+	// replace dependencies on the matrix step with dependencies
+	// on each expanded step. The step is copied before it is
+	// modified, since it is shared with the parsed pipeline.
+	for i, step := range expanded {
+		var deps []string
+		var changed bool
+		for _, dep := range step.DependsOn {
+			if v, ok := names[dep]; ok {
+				deps = append(deps, v...)
+				changed = true
+			} else {
+				deps = append(deps, dep)
+			}
+		}
+		if changed {
+			dst := *step
+			dst.DependsOn = deps
+			expanded[i] = &dst
+		}
+	}
+	return expanded
+}
+
+// helper function returns every combination of matrix values,
+// ordered by the matrix key name.
+func matrixAxes(matrix map[string][]string) []map[string]string {
+	var keys []string
+	for k := range matrix {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	axes := []map[string]string{{}}
+	for _, key := range keys {
+		var next []map[string]string
+		for _, axis := range axes {
+			for _, value := range matrix[key] {
+				dst := map[string]string{key: value}
+				for k, v := range axis {
+					dst[k] = v
+				}
+				next = append(next, dst)
+			}
+		}
+		axes = next
+	}
+	return axes
+}
+
+// helper function returns a copy of the step for the matrix
+// axis. The axis values are substituted into the step image,
+// environment and commands, and appended to the step name.
+func expandStep(src *resource.Step, axis map[string]string) *resource.Step {
+	var keys, pairs []string
+	for k := range axis {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+axis[k])
+	}
+	replace := func(s string) string {
+		return matrixRE.ReplaceAllStringFunc(s, func(match string) string {
+			if v, ok := axis[matrixRE.FindStringSubmatch(match)[1]]; ok {
+				return v
+			}
+			return match
+		})
+	}
+
+	dst := *src
+	dst.Matrix = nil
+	dst.Name = fmt.Sprintf("%s (%s)", src.Name, strings.Join(pairs, ", "))
+	dst.Image = replace(src.Image)
+	dst.Commands = nil
+	for _, command := range src.Commands {
+		dst.Commands = append(dst.Commands, replace(command))
+	}
+	if src.Environment != nil {
+		dst.Environment = map[string]*manifest.Variable{}
+		for k, v := range src.Environment {
+			if v == nil {
+				dst.Environment[k] = v
+				continue
+			}
+			dst.Environment[k] = &manifest.Variable{
+				Value:  replace(v.Value),
+				Secret: v.Secret,
+			}
+		}
+	}
+	return &dst
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package compiler
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-docker/engine/resource"
+
+	"github.com/drone/runner-go/manifest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func Test_expandMatrix(t *testing.T) {
+	test := &resource.Step{
+		Name:     "test",
+		Image:    "golang:{{ matrix.go }}",
+		Commands: []string{"go test -tags {{ matrix.db }}"},
+		Environment: map[string]*manifest.Variable{
+			"DATABASE": {Value: "{{ matrix.db }}"},
+			"VERSION":  {Value: "{{matrix.go}}-{{ matrix.os }}"},
+			"TOKEN":    {Secret: "token"},
+		},
+		Matrix: map[string][]string{
+			"go": {"1.20", "1.21"},
+			"db": {"pg"},
+		},
+	}
+	publish := &resource.Step{
+		Name:      "publish",
+		DependsOn: []string{"build", "test"},
+	}
+	steps := expandMatrix([]*resource.Step{test, publish})
+	if got, want := len(steps), 3; got != want {
+		t.Errorf("Want %d steps, got %d", want, got)
+		return
+	}
+
+	if got, want := steps[0].Name, "test (db=pg, go=1.20)"; got != want {
+		t.Errorf("Want step name %q, got %q", want, got)
+	}
+	if got, want := steps[1].Name, "test (db=pg, go=1.21)"; got != want {
+		t.Errorf("Want step name %q, got %q", want, got)
+	}
+	if got, want := steps[1].Image, "golang:1.21"; got != want {
+		t.Errorf("Want image %q, got %q", want, got)
+	}
+	if got, want := steps[1].Commands, []string{"go test -tags pg"}; !cmp.Equal(got, want) {
+		t.Errorf("Want commands %q, got %q", want, got)
+	}
+	if got, want := steps[1].Environment["DATABASE"].Value, "pg"; got != want {
+		t.Errorf("Want environment value %q, got %q", want, got)
+	}
+	if got, want := steps[1].Environment["VERSION"].Value, "1.21-{{ matrix.os }}"; got != want {
+		t.Errorf("Want environment value %q, got %q", want, got)
+	}
+	if got, want := steps[1].Environment["TOKEN"].Secret, "token"; got != want {
+		t.Errorf("Want environment secret %q, got %q", want, got)
+	}
+	if steps[1].Matrix != nil {
+		t.Errorf("Expect expanded step matrix removed")
+	}
+
+	want := []string{"build", "test (db=pg, go=1.20)", "test (db=pg, go=1.21)"}
+	if diff := cmp.Diff(steps[2].DependsOn, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	// the parsed pipeline steps should not be modified.
+	if got, want := publish.DependsOn, []string{"build", "test"}; !cmp.Equal(got, want) {
+		t.Errorf("Expect original step dependencies unchanged, got %q", got)
+	}
+	if test.Environment["DATABASE"].Value != "{{ matrix.db }}" {
+		t.Errorf("Expect original step environment unchanged")
+	}
+}
+
+func Test_expandMatrix_None(t *testing.T) {
+	steps := []*resource.Step{
+		{Name: "build"},
+		{Name: "test", DependsOn: []string{"build"}},
+	}
+	if got := expandMatrix(steps); !cmp.Equal(got, steps) {
+		t.Errorf("Expect steps unchanged")
+	}
+}
@@ -7,17 +7,25 @@ package compiler
 import (
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell"
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell/bash"
 	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell/powershell"
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell/python"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
 )
 
 // helper function configures the pipeline script for the
-// target operating system.
+// target operating system and shell.
 func setupScript(src *resource.Step, dst *engine.Step, os string) {
 	if len(src.Commands) > 0 {
-		switch os {
-		case "windows":
+		switch {
+		case os == "windows":
 			setupScriptWindows(src, dst)
+		case src.Shell == "bash":
+			setupScriptBash(src, dst)
+		case src.Shell == "pwsh", src.Shell == "powershell":
+			setupScriptPwsh(src, dst)
+		case src.Shell == "python":
+			setupScriptPython(src, dst)
 		default:
 			setupScriptPosix(src, dst)
 		}
@@ -31,6 +39,10 @@ func setupScriptWindows(src *resource.Step, dst *engine.Step) {
 	dst.Command = []string{"echo $Env:DRONE_SCRIPT | iex"}
 	dst.Envs["DRONE_SCRIPT"] = powershell.Script(src.Commands)
 	dst.Envs["SHELL"] = "powershell.exe"
+	if src.Shell == "pwsh" {
+		dst.Entrypoint[0] = "pwsh"
+		dst.Envs["SHELL"] = "pwsh.exe"
+	}
 }
 
 // helper function configures the pipeline script for the
@@ -40,3 +52,27 @@ func setupScriptPosix(src *resource.Step, dst *engine.Step) {
 	dst.Command = []string{`echo "$DRONE_SCRIPT" | /bin/sh`}
 	dst.Envs["DRONE_SCRIPT"] = shell.Script(src.Commands)
 }
+
+// helper function configures the pipeline script for the
+// bash shell.
+func setupScriptBash(src *resource.Step, dst *engine.Step) {
+	dst.Entrypoint = []string{"/bin/bash", "-c"}
+	dst.Command = []string{`echo "$DRONE_SCRIPT" | /bin/bash`}
+	dst.Envs["DRONE_SCRIPT"] = bash.Script(src.Commands)
+}
+
+// helper function configures the pipeline script for the
+// powershell core shell on the linux operating system.
+func setupScriptPwsh(src *resource.Step, dst *engine.Step) {
+	dst.Entrypoint = []string{"pwsh", "-noprofile", "-noninteractive", "-command"}
+	dst.Command = []string{"echo $Env:DRONE_SCRIPT | iex"}
+	dst.Envs["DRONE_SCRIPT"] = powershell.ScriptPosix(src.Commands)
+}
+
+// helper function configures the pipeline script for the
+// python interpreter.
+func setupScriptPython(src *resource.Step, dst *engine.Step) {
+	dst.Entrypoint = []string{"python3", "-c"}
+	dst.Command = []string{`import os; exec(os.environ["DRONE_SCRIPT"])`}
+	dst.Envs["DRONE_SCRIPT"] = python.Script(src.Commands)
+}
@@ -3,3 +3,36 @@
 // that can be found in the LICENSE file.
 
 package compiler
+
+import (
+	"testing"
+
+	"github.com/drone-runners/drone-runner-docker/engine"
+	"github.com/drone-runners/drone-runner-docker/engine/resource"
+)
+
+func TestSetupScript(t *testing.T) {
+	tests := []struct {
+		os, shell  string
+		entrypoint string
+	}{
+		{os: "linux", shell: "", entrypoint: "/bin/sh"},
+		{os: "linux", shell: "sh", entrypoint: "/bin/sh"},
+		{os: "linux", shell: "bash", entrypoint: "/bin/bash"},
+		{os: "linux", shell: "pwsh", entrypoint: "pwsh"},
+		{os: "linux", shell: "python", entrypoint: "python3"},
+		{os: "windows", shell: "", entrypoint: "powershell"},
+		{os: "windows", shell: "pwsh", entrypoint: "pwsh"},
+	}
+	for _, test := range tests {
+		src := &resource.Step{Shell: test.shell, Commands: []string{"true"}}
+		dst := &engine.Step{Envs: map[string]string{}}
+		setupScript(src, dst, test.os)
+		if got, want := dst.Entrypoint[0], test.entrypoint; got != want {
+			t.Errorf("Want entrypoint %q for shell %q on %s, got %q", want, test.shell, test.os, got)
+		}
+		if dst.Envs["DRONE_SCRIPT"] == "" {
+			t.Errorf("Expect script for shell %q on %s", test.shell, test.os)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package bash provides functions for converting shell commands
+// to bash scripts.
+package bash
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell"
+)
+
+// Script converts a slice of individual shell commands to
+// a bash script.
+func Script(commands []string) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, optionScript)
+	buf.WriteString(shell.SectionScript)
+	fmt.Fprintf(buf, tmateScript)
+	fmt.Fprintln(buf)
+	for i, command := range commands {
+		escaped := fmt.Sprintf("%q", command)
+		escaped = strings.Replace(escaped, "$", `\$`, -1)
+		buf.WriteString(fmt.Sprintf(
+			traceScript,
+			i+1,
+			escaped,
+			command,
+		))
+	}
+	return buf.String()
+}
+
+// optionScript is a helper script this is added to the build
+// to set shell options, in this case, to exit on error and to
+// fail a pipeline if any command in the pipeline fails.
+const optionScript = `
+if [ ! -z "${DRONE_NETRC_FILE}" ]; then
+	echo $DRONE_NETRC_FILE > $HOME/.netrc
+	chmod 600 $HOME/.netrc
+fi
+
+unset DRONE_SCRIPT
+unset DRONE_NETRC_MACHINE
+unset DRONE_NETRC_USERNAME
+unset DRONE_NETRC_PASSWORD
+unset DRONE_NETRC_FILE
+
+set -eo pipefail
+`
+
+// traceScript is a helper script that is added to
+// the build script to trace a command.
+const traceScript = `
+drone_section_start %d
+echo + %s
+%s
+drone_section_end
+`
+
+const tmateScript = `
+remote_debug() {
+	if [ "$?" -ne "0" ]; then
+		/usr/drone/bin/tmate -F
+	fi
+}
+
+if [ "${DRONE_BUILD_DEBUG}" = "true" ]; then
+	if [ ! -z "${DRONE_TMATE_HOST}" ]; then
+		echo "set -g tmate-server-host $DRONE_TMATE_HOST" >> $HOME/.tmate.conf
+		echo "set -g tmate-server-port $DRONE_TMATE_PORT" >> $HOME/.tmate.conf
+		echo "set -g tmate-server-rsa-fingerprint $DRONE_TMATE_FINGERPRINT_RSA" >> $HOME/.tmate.conf
+		echo "set -g tmate-server-ed25519-fingerprint $DRONE_TMATE_FINGERPRINT_ED25519" >> $HOME/.tmate.conf
+
+		if [ ! -z "${DRONE_TMATE_AUTHORIZED_KEYS}" ]; then
+			echo "$DRONE_TMATE_AUTHORIZED_KEYS" > $HOME/.tmate.authorized_keys
+			echo "set -g tmate-authorized-keys \"$HOME/.tmate.authorized_keys\"" >> $HOME/.tmate.conf
+		fi
+	fi
+	trap 'drone_section_exit || remote_debug' EXIT
+fi
+`
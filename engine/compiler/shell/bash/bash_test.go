@@ -0,0 +1,20 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package bash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	got := Script([]string{"go build", "go test | tee test.out"})
+	if !strings.Contains(got, "set -eo pipefail") {
+		t.Errorf("Expect script fails when a pipeline command fails")
+	}
+	if !strings.Contains(got, "echo + \"go test | tee test.out\"\ngo test | tee test.out\ndrone_section_end\n") {
+		t.Errorf("Expect script traces commands")
+	}
+}
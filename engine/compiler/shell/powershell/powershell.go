@@ -10,6 +10,8 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell"
 )
 
 // Script converts a slice of individual shell commands to
@@ -18,12 +20,14 @@ func Script(commands []string) string {
 	buf := new(bytes.Buffer)
 	fmt.Fprintln(buf)
 	fmt.Fprintf(buf, optionScript)
+	buf.WriteString(sectionScript)
 	fmt.Fprintln(buf)
-	for _, command := range commands {
+	for i, command := range commands {
 		escaped := fmt.Sprintf("%q", "+ "+command)
 		escaped = strings.Replace(escaped, "$", "`$", -1)
 		buf.WriteString(fmt.Sprintf(
 			traceScript,
+			i+1,
 			escaped,
 			command,
 		))
@@ -50,10 +54,115 @@ password $Env:DRONE_NETRC_PASSWORD
 $erroractionpreference = "stop"
 `
 
+// sectionScript is a helper script that is added to the build
+// script to write a section marker before and after each
+// command. The end marker records the exit code and duration
+// of the command. A command that throws a terminating error
+// is recorded with exit code 1.
+const sectionScript = `
+function drone_section_start($id) {
+	$Global:DRONE_SECTION_ID = $id
+	$Global:DRONE_SECTION_TIME = [DateTimeOffset]::UtcNow.ToUnixTimeSeconds()
+	echo "` + shell.SectionStart + ` id=$Global:DRONE_SECTION_ID time=$Global:DRONE_SECTION_TIME"
+}
+
+function drone_section_end($code) {
+	if ($code -eq $null) { $code = 0 }
+	$now = [DateTimeOffset]::UtcNow.ToUnixTimeSeconds()
+	$elapsed = $now - $Global:DRONE_SECTION_TIME
+	echo "` + shell.SectionEnd + ` id=$Global:DRONE_SECTION_ID time=$now exit=$code duration=$elapsed"
+	echo "+ finished in ${elapsed}s (exit code $code)"
+}
+`
+
 // traceScript is a helper script that is added to
 // the build script to trace a command.
 const traceScript = `
+drone_section_start %d
 echo %s
+$drone_section_code = 1
+try {
 %s
+$drone_section_code = $LastExitCode
+} finally {
+drone_section_end $drone_section_code
+}
 if ($LastExitCode -gt 0) { exit $LastExitCode }
 `
+
+// ScriptPosix converts a slice of individual shell commands to
+// a powershell script for the linux operating system.
+func ScriptPosix(commands []string) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf)
+	fmt.Fprintf(buf, optionScriptPosix)
+	buf.WriteString(sectionScript)
+	fmt.Fprintf(buf, tmateScriptPosix)
+	fmt.Fprintln(buf)
+	for i, command := range commands {
+		escaped := fmt.Sprintf("%q", "+ "+command)
+		escaped = strings.Replace(escaped, "$", "`$", -1)
+		buf.WriteString(fmt.Sprintf(
+			traceScriptPosix,
+			i+1,
+			escaped,
+			command,
+		))
+	}
+	return buf.String()
+}
+
+// optionScriptPosix is a helper script this is added to the
+// build to set shell options, in this case, to exit on error.
+const optionScriptPosix = `
+if ($Env:DRONE_NETRC_FILE) {
+	$Env:DRONE_NETRC_FILE > (Join-Path $HOME '.netrc');
+	chmod 600 (Join-Path $HOME '.netrc');
+}
+[Environment]::SetEnvironmentVariable("DRONE_NETRC_MACHINE", $null);
+[Environment]::SetEnvironmentVariable("DRONE_NETRC_USERNAME", $null);
+[Environment]::SetEnvironmentVariable("DRONE_NETRC_PASSWORD", $null);
+[Environment]::SetEnvironmentVariable("DRONE_NETRC_FILE", $null);
+[Environment]::SetEnvironmentVariable("DRONE_SCRIPT", $null);
+
+$erroractionpreference = "stop"
+`
+
+// traceScriptPosix is a helper script that is added to
+// the build script to trace a command.
+const traceScriptPosix = `
+drone_section_start %d
+echo %s
+$drone_section_code = 1
+try {
+%s
+$drone_section_code = $LastExitCode
+} finally {
+drone_section_end $drone_section_code
+}
+if ($LastExitCode -gt 0) { remote_debug; exit $LastExitCode }
+`
+
+const tmateScriptPosix = `
+function remote_debug {
+	if ($Env:DRONE_BUILD_DEBUG -eq "true") {
+		/usr/drone/bin/tmate -F
+	}
+}
+
+if ($Env:DRONE_BUILD_DEBUG -eq "true" -and $Env:DRONE_TMATE_HOST) {
+	$conf = Join-Path $HOME '.tmate.conf'
+	"set -g tmate-server-host $Env:DRONE_TMATE_HOST" >> $conf
+	"set -g tmate-server-port $Env:DRONE_TMATE_PORT" >> $conf
+	"set -g tmate-server-rsa-fingerprint $Env:DRONE_TMATE_FINGERPRINT_RSA" >> $conf
+	"set -g tmate-server-ed25519-fingerprint $Env:DRONE_TMATE_FINGERPRINT_ED25519" >> $conf
+
+	if ($Env:DRONE_TMATE_AUTHORIZED_KEYS) {
+		$keys = Join-Path $HOME '.tmate.authorized_keys'
+		$Env:DRONE_TMATE_AUTHORIZED_KEYS > $keys
+		"set -g tmate-authorized-keys ""$keys""" >> $conf
+	}
+}
+
+trap { remote_debug; break }
+`
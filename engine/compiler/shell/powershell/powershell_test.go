@@ -3,3 +3,23 @@
 // that can be found in the LICENSE file.
 
 package powershell
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript_Sections(t *testing.T) {
+	for _, script := range []func([]string) string{Script, ScriptPosix} {
+		got := script([]string{"go build", "go test"})
+		for _, want := range []string{
+			"\ndrone_section_start 1\necho \"+ go build\"\n",
+			"\ndrone_section_start 2\necho \"+ go test\"\n",
+			"try {\ngo test\n$drone_section_code = $LastExitCode\n} finally {\ndrone_section_end $drone_section_code\n}\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Errorf("Expect command wrapped in section markers, got %s", got)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package python provides functions for converting commands
+// to python scripts.
+package python
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/drone-runners/drone-runner-docker/engine/compiler/shell"
+)
+
+// Script converts a slice of individual python statements to
+// a python script. The statements share a single global scope,
+// and the script exits on the first uncaught exception.
+func Script(commands []string) string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintln(buf)
+	buf.WriteString(optionScript)
+	buf.WriteString(sectionScript)
+	buf.WriteString(tmateScript)
+	fmt.Fprintln(buf)
+	fmt.Fprintln(buf, "try:")
+	for i, command := range commands {
+		// the go quoted string is a valid python string
+		// literal, which prevents the command from being
+		// interpreted by the script.
+		escaped := fmt.Sprintf("%q", command)
+		buf.WriteString(fmt.Sprintf(
+			traceScript,
+			i+1,
+			escaped,
+			escaped,
+		))
+	}
+	buf.WriteString(exitScript)
+	return buf.String()
+}
+
+// optionScript is a helper script this is added to the build
+// to write the netrc file and unset the netrc variables.
+const optionScript = `
+import os
+import subprocess
+import sys
+import time
+
+if os.environ.get("DRONE_NETRC_FILE"):
+    netrc = os.path.join(os.path.expanduser("~"), ".netrc")
+    with open(netrc, "w") as f:
+        f.write(os.environ["DRONE_NETRC_FILE"] + "\n")
+    os.chmod(netrc, 0o600)
+
+for name in [
+    "DRONE_SCRIPT",
+    "DRONE_NETRC_MACHINE",
+    "DRONE_NETRC_USERNAME",
+    "DRONE_NETRC_PASSWORD",
+    "DRONE_NETRC_FILE",
+]:
+    os.environ.pop(name, None)
+`
+
+// sectionScript is a helper script that is added to the build
+// script to write a section marker before and after each
+// statement. The end marker records the exit code and duration
+// of the statement. A statement that raises an exception other
+// than SystemExit is recorded with exit code 1.
+const sectionScript = `
+class drone_section:
+    def __init__(self, id):
+        self.id = id
+
+    def __enter__(self):
+        self.time = int(time.time())
+        print("` + shell.SectionStart + ` id=%d time=%d" % (self.id, self.time), flush=True)
+
+    def __exit__(self, kind, value, tb):
+        code = 0
+        if kind is SystemExit:
+            code = value.code if isinstance(value.code, int) else int(value.code is not None)
+        elif kind is not None:
+            code = 1
+        now = int(time.time())
+        print("` + shell.SectionEnd + ` id=%d time=%d exit=%d duration=%d" % (self.id, now, code, now - self.time), flush=True)
+        print("+ finished in %ds (exit code %d)" % (now - self.time, code), flush=True)
+        return False
+`
+
+// traceScript is a helper script that is added to
+// the build script to trace a statement.
+const traceScript = `
+    with drone_section(%d):
+        print("+ " + %s, flush=True)
+        exec(compile(%s, "<drone>", "exec"))
+`
+
+// exitScript is a helper script that is added to the build
+// script to start the remote debugger on failure.
+const exitScript = `
+except SystemExit as e:
+    if e.code not in (None, 0):
+        remote_debug()
+    raise
+except BaseException:
+    remote_debug()
+    raise
+`
+
+const tmateScript = `
+def remote_debug():
+    if os.environ.get("DRONE_BUILD_DEBUG") != "true":
+        return
+    if os.environ.get("DRONE_TMATE_HOST"):
+        conf = os.path.join(os.path.expanduser("~"), ".tmate.conf")
+        with open(conf, "a") as f:
+            f.write("set -g tmate-server-host %s\n" % os.environ.get("DRONE_TMATE_HOST"))
+            f.write("set -g tmate-server-port %s\n" % os.environ.get("DRONE_TMATE_PORT"))
+            f.write("set -g tmate-server-rsa-fingerprint %s\n" % os.environ.get("DRONE_TMATE_FINGERPRINT_RSA"))
+            f.write("set -g tmate-server-ed25519-fingerprint %s\n" % os.environ.get("DRONE_TMATE_FINGERPRINT_ED25519"))
+            if os.environ.get("DRONE_TMATE_AUTHORIZED_KEYS"):
+                keys = os.path.join(os.path.expanduser("~"), ".tmate.authorized_keys")
+                with open(keys, "w") as k:
+                    k.write(os.environ["DRONE_TMATE_AUTHORIZED_KEYS"] + "\n")
+                f.write("set -g tmate-authorized-keys \"%s\"\n" % keys)
+    subprocess.call(["/usr/drone/bin/tmate", "-F"])
+`
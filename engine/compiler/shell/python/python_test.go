@@ -0,0 +1,22 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package python
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScript(t *testing.T) {
+	got := Script([]string{`print("hello $world")`})
+	want := `
+    with drone_section(1):
+        print("+ " + "print(\"hello $world\")", flush=True)
+        exec(compile("print(\"hello $world\")", "<drone>", "exec"))
+`
+	if !strings.Contains(got, want) {
+		t.Errorf("Expect script traces and executes statements, got %s", got)
+	}
+}
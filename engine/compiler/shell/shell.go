@@ -18,13 +18,15 @@ func Script(commands []string) string {
 	buf := new(bytes.Buffer)
 	fmt.Fprintln(buf)
 	fmt.Fprintf(buf, optionScript)
+	buf.WriteString(SectionScript)
 	fmt.Fprintf(buf, tmateScript)
 	fmt.Fprintln(buf)
-	for _, command := range commands {
+	for i, command := range commands {
 		escaped := fmt.Sprintf("%q", command)
 		escaped = strings.Replace(escaped, "$", `\$`, -1)
 		buf.WriteString(fmt.Sprintf(
 			traceScript,
+			i+1,
 			escaped,
 			command,
 		))
@@ -49,11 +51,62 @@ unset DRONE_NETRC_FILE
 set -e
 `
 
+// SectionStart is the marker written to the logs before each
+// command is executed.
+const SectionStart = "##[drone:section:start]"
+
+// SectionEnd is the marker written to the logs after each
+// command is executed.
+const SectionEnd = "##[drone:section:end]"
+
+// IsSection returns true if the log line is a section marker.
+func IsSection(line string) bool {
+	return strings.HasPrefix(line, SectionStart) ||
+		strings.HasPrefix(line, SectionEnd)
+}
+
+// SectionScript is a helper script that is added to the build
+// script to write a section marker before and after each
+// command. The end marker records the exit code and duration
+// of the command, and is written on exit if the command fails.
+// The end marker always succeeds when written after a command,
+// since a non-zero exit code that does not abort the script
+// (eg. "false && true") must not abort the script under set -e.
+// Only the exit trap passes the exit code through.
+const SectionScript = `
+drone_section_start() {
+	DRONE_SECTION_ID=$1
+	DRONE_SECTION_TIME=$(date +%s 2>/dev/null || echo 0)
+	echo "` + SectionStart + ` id=${DRONE_SECTION_ID} time=${DRONE_SECTION_TIME}"
+}
+
+drone_section_end() {
+	DRONE_SECTION_CODE=$?
+	if [ -n "${DRONE_SECTION_ID}" ]; then
+		DRONE_SECTION_NOW=$(date +%s 2>/dev/null || echo 0)
+		DRONE_SECTION_ELAPSED=$((DRONE_SECTION_NOW - DRONE_SECTION_TIME))
+		echo "` + SectionEnd + ` id=${DRONE_SECTION_ID} time=${DRONE_SECTION_NOW} exit=${DRONE_SECTION_CODE} duration=${DRONE_SECTION_ELAPSED}"
+		echo "+ finished in ${DRONE_SECTION_ELAPSED}s (exit code ${DRONE_SECTION_CODE})"
+		DRONE_SECTION_ID=
+	fi
+	return 0
+}
+
+drone_section_exit() {
+	drone_section_end
+	return $DRONE_SECTION_CODE
+}
+
+trap drone_section_exit EXIT
+`
+
 // traceScript is a helper script that is added to
 // the build script to trace a command.
 const traceScript = `
+drone_section_start %d
 echo + %s
 %s
+drone_section_end
 `
 
 const tmateScript = `
@@ -75,6 +128,6 @@ if [ "${DRONE_BUILD_DEBUG}" = "true" ]; then
 			echo "set -g tmate-authorized-keys \"$HOME/.tmate.authorized_keys\"" >> $HOME/.tmate.conf
 		fi
 	fi
-	trap remote_debug EXIT
+	trap 'drone_section_exit || remote_debug' EXIT
 fi
 `
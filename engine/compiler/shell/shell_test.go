@@ -3,3 +3,85 @@
 // that can be found in the LICENSE file.
 
 package shell
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestScript_Sections(t *testing.T) {
+	got := Script([]string{"go build", "go test"})
+	for _, want := range []string{
+		"\ndrone_section_start 1\necho + \"go build\"\ngo build\ndrone_section_end\n",
+		"\ndrone_section_start 2\necho + \"go test\"\ngo test\ndrone_section_end\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expect command wrapped in section markers, got %s", got)
+		}
+	}
+}
+
+// This test verifies that a command that returns a non-zero
+// exit code without failing, such as "false && true", does not
+// abort the script, and that a failing command exits the script
+// with the command exit code.
+func TestScript_Exec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	tests := []struct {
+		commands []string
+		code     int
+		output   string
+	}{
+		{
+			commands: []string{"false && true", "echo done"},
+			code:     0,
+			output:   "(exit code 0)",
+		},
+		{
+			commands: []string{"exit 3", "echo done"},
+			code:     3,
+			output:   "exit=3",
+		},
+	}
+	for _, test := range tests {
+		cmd := exec.Command("sh", "-c", Script(test.commands))
+		cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + t.TempDir()}
+		out, err := cmd.CombinedOutput()
+		code := 0
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if code != test.code {
+			t.Errorf("Want exit code %d for %q, got %d: %s", test.code, test.commands, code, out)
+		}
+		if got := string(out); !strings.Contains(got, test.output) {
+			t.Errorf("Want output %q for %q, got %s", test.output, test.commands, got)
+		}
+		if got := string(out); test.code == 0 && !strings.Contains(got, "\ndone\n") {
+			t.Errorf("Expect all commands executed for %q, got %s", test.commands, got)
+		}
+	}
+}
+
+func TestIsSection(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "##[drone:section:start] id=1 time=1590000000", want: true},
+		{line: "##[drone:section:end] id=1 time=1590000012 exit=0 duration=12", want: true},
+		{line: "+ go test", want: false},
+		{line: "ok  github.com/octocat/hello-world 0.012s", want: false},
+	}
+	for _, test := range tests {
+		if got := IsSection(test.line); got != test.want {
+			t.Errorf("Want IsSection %v for %q", test.want, test.line)
+		}
+	}
+}
@@ -6,6 +6,7 @@ package compiler
 
 import (
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
@@ -27,15 +28,24 @@ func createStep(spec *resource.Pipeline, src *resource.Step) *engine.Step {
 		DNS:          src.DNS,
 		DNSSearch:    src.DNSSearch,
 		Envs:         convertStaticEnv(src.Environment),
+		Expr:         src.When.Expr,
 		ExtraHosts:   src.ExtraHosts,
 		IgnoreStderr: false,
 		IgnoreStdout: false,
 		Network:      src.Network,
 		Privileged:   src.Privileged,
-		Pull:         convertPullPolicy(src.Pull),
+		CapAdd:       src.CapAdd,
+		CapDrop:      src.CapDrop,
+		SecurityOpt:  src.SecurityOpt,
+		ReadOnly:     src.ReadOnly,
+		NoNewPrivs:   src.NoNewPrivs,
+		Runtime:      src.Runtime,
 		User:         src.User,
 		Secrets:      convertSecretEnv(src.Environment),
 		ShmSize:      int64(src.ShmSize),
+		StopSignal:   src.StopSignal,
+		StopGrace:    time.Duration(src.StopGrace),
+		Timeout:      time.Duration(src.Timeout),
 		WorkingDir:   src.WorkingDir,
 
 		//
@@ -48,6 +58,18 @@ func createStep(spec *resource.Pipeline, src *resource.Step) *engine.Step {
 		// Resources:    toResources(src), // TODO
 	}
 
+	// set the path conditions, which are evaluated at runtime
+	// against the files changed by the build.
+	if paths := src.When.Paths; len(paths.Include) != 0 || len(paths.Exclude) != 0 {
+		dst.Paths = &engine.Paths{
+			Include: paths.Include,
+			Exclude: paths.Exclude,
+		}
+	}
+
+	// set the image pull policy.
+	dst.Pull, dst.PullMaxAge = convertPullPolicy(src.Pull)
+
 	// set container limits
 	if v := int64(src.MemLimit); v > 0 {
 		dst.MemLimit = v
@@ -55,6 +77,9 @@ func createStep(spec *resource.Pipeline, src *resource.Step) *engine.Step {
 	if v := int64(src.MemSwapLimit); v > 0 {
 		dst.MemSwapLimit = v
 	}
+	dst.PidsLimit = src.PidsLimit
+	dst.Sysctls = src.Sysctls
+	dst.Ulimits = convertUlimits(src.Ulimits)
 
 	// appends the volumes to the container def.
 	for _, vol := range src.Volumes {
@@ -108,6 +133,38 @@ func createStep(spec *resource.Pipeline, src *resource.Step) *engine.Step {
 		dst.RunPolicy = runtime.RunOnFailure
 	}
 
+	// set the pipeline step retry policy. failed steps are
+	// re-run in a new container until the attempts are
+	// exhausted.
+	if src.Retry != nil && src.Retry.Attempts > 1 {
+		dst.Retry = &engine.Retry{
+			Attempts:  src.Retry.Attempts,
+			Delay:     time.Duration(src.Retry.Delay),
+			Backoff:   src.Retry.Backoff,
+			ExitCodes: src.Retry.ExitCodes,
+		}
+	}
+
+	// set the service readiness probe. steps that depend
+	// on the service are blocked until the probe succeeds.
+	if src.Ready != nil {
+		dst.Ready = &engine.Ready{
+			Healthcheck: src.Ready.Healthcheck,
+			Port:        src.Ready.Port,
+			Command:     src.Ready.Command,
+			Interval:    time.Duration(src.Ready.Interval),
+			Timeout:     time.Duration(src.Ready.Timeout),
+		}
+	}
+
+	// set the step artifacts. the paths are resolved
+	// against the workspace in compiler.go.
+	if len(src.Artifacts) != 0 {
+		dst.Artifacts = &engine.Artifacts{
+			Paths: append([]string(nil), src.Artifacts...),
+		}
+	}
+
 	// set the pipeline failure policy. steps can choose
 	// to ignore the failure, or fail fast.
 	switch src.Failure {
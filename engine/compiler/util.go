@@ -5,7 +5,9 @@
 package compiler
 
 import (
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
@@ -46,6 +48,17 @@ func isGraph(spec *engine.Spec) bool {
 	return false
 }
 
+// helper function returns true if any pipeline step defines
+// path conditions.
+func hasPaths(spec *engine.Spec) bool {
+	for _, step := range spec.Steps {
+		if step.Paths != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // helper function creates the dependency graph for serial
 // pipeline execution.
 func configureSerial(spec *engine.Spec) {
@@ -123,37 +136,130 @@ func removeCloneDeps(spec *engine.Spec) {
 	}
 }
 
-// helper function modifies the pipeline dependency graph to
-// account for the clone step.
-func convertPullPolicy(s string) engine.PullPolicy {
-	switch strings.ToLower(s) {
-	case "always":
-		return engine.PullAlways
-	case "if-not-exists":
-		return engine.PullIfNotExists
-	case "never":
-		return engine.PullNever
-	default:
-		return engine.PullDefault
+// helper function converts the pull policy string to the
+// pull policy enumeration, and the maximum image age for the
+// if-older-than pull policy. Invalid values are rejected by
+// the linter and at startup, and fall back to the default.
+func convertPullPolicy(s string) (engine.PullPolicy, time.Duration) {
+	policy, maxAge, _ := engine.ParsePullPolicy(s)
+	return policy, maxAge
+}
+
+// helper function converts the ulimits to a list sorted by
+// name, which ensures the container configuration is stable.
+func convertUlimits(src map[string]*resource.Ulimit) []*engine.Ulimit {
+	var dst []*engine.Ulimit
+	for name, ulimit := range src {
+		if ulimit == nil {
+			continue
+		}
+		dst = append(dst, &engine.Ulimit{
+			Name: name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
 	}
+	sort.Slice(dst, func(i, j int) bool {
+		return dst[i].Name < dst[j].Name
+	})
+	return dst
+}
+
+// helper function returns the step limit, defaulting to the
+// runner limit if the step does not define a limit. Untrusted
+// repositories cannot exceed the runner limit. A negative step
+// limit is unlimited.
+func applyLimit(step, runner int64, trusted bool) int64 {
+	if step == 0 {
+		return runner
+	}
+	if runner > 0 && !trusted && (step < 0 || step > runner) {
+		return runner
+	}
+	return step
+}
+
+// helper function appends the runner ulimits to the step
+// ulimits. Untrusted repositories cannot exceed the runner
+// ulimits.
+func applyUlimits(step, runner []*engine.Ulimit, trusted bool) []*engine.Ulimit {
+	for _, limit := range runner {
+		var found bool
+		for _, ulimit := range step {
+			if ulimit.Name != limit.Name {
+				continue
+			}
+			found = true
+			ulimit.Soft = applyLimit(ulimit.Soft, limit.Soft, trusted)
+			ulimit.Hard = applyLimit(ulimit.Hard, limit.Hard, trusted)
+		}
+		if !found {
+			step = append(step, &engine.Ulimit{
+				Name: limit.Name,
+				Soft: limit.Soft,
+				Hard: limit.Hard,
+			})
+		}
+	}
+	return step
+}
+
+// helper function returns the cache scope, which isolates the
+// caches of each repository, trust level and target branch.
+func cacheScope(repo *drone.Repo, build *drone.Build) string {
+	trust := "untrusted"
+	if repo.Trusted {
+		trust = "trusted"
+	}
+	return repo.Slug + ":" + trust + ":" + build.Target
+}
+
+// helper function applies the hardened profile to the step.
+// All capabilities are dropped except the allowlist, the
+// process limit cannot exceed the profile limit, and the step
+// cannot run in privileged mode.
+func applyHardening(step *engine.Step, profile Hardening) {
+	step.Privileged = false
+	step.CapDrop = []string{"ALL"}
+	step.CapAdd = append([]string(nil), profile.CapAdd...)
+	step.NoNewPrivs = true
+	step.PidsLimit = applyLimit(step.PidsLimit, profile.PidsLimit, false)
+	if profile.Seccomp != "" {
+		step.SecurityOpt = append(step.SecurityOpt, "seccomp="+profile.Seccomp)
+	}
+}
+
+// helper function returns the image repositories declared
+// in the step settings, which the step can build using the
+// docker socket proxy. Repositories sourced from secrets are
+// ignored.
+func proxyRepos(step *resource.Step) []string {
+	param, ok := step.Settings["repo"]
+	if !ok || param == nil || param.Secret != "" {
+		return nil
+	}
+	switch v := param.Value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var repos []string
+		for _, repo := range v {
+			if s, ok := repo.(string); ok {
+				repos = append(repos, s)
+			}
+		}
+		return repos
+	}
+	return nil
 }
 
 // helper function returns true if the environment variable
 // is restricted for internal-use only.
 func isRestrictedVariable(env map[string]*manifest.Variable) bool {
-	for _, name := range restrictedVars {
+	for _, name := range engine.RestrictedVars {
 		if _, ok := env[name]; ok {
 			return true
 		}
 	}
 	return false
 }
-
-// list of restricted variables
-var restrictedVars = []string{
-	"XDG_RUNTIME_DIR",
-	"DOCKER_OPTS",
-	"DOCKER_HOST",
-	"PATH",
-	"HOME",
-}
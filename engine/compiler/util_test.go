@@ -10,6 +10,7 @@ import (
 	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
 
+	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 
 	"github.com/google/go-cmp/cmp"
@@ -199,3 +200,116 @@ func Test_removeCloneDeps_CloneEnabled(t *testing.T) {
 		t.Log(diff)
 	}
 }
+
+func Test_applyLimit(t *testing.T) {
+	tests := []struct {
+		step, runner int64
+		trusted      bool
+		want         int64
+	}{
+		{step: 0, runner: 100, want: 100},
+		{step: 50, runner: 100, want: 50},
+		{step: 200, runner: 100, want: 100},
+		{step: -1, runner: 100, want: 100},
+		{step: 200, runner: 100, trusted: true, want: 200},
+		{step: -1, runner: 100, trusted: true, want: -1},
+		{step: 200, runner: 0, want: 200},
+	}
+	for _, test := range tests {
+		if got := applyLimit(test.step, test.runner, test.trusted); got != test.want {
+			t.Errorf("Want limit %d for step limit %d, got %d", test.want, test.step, got)
+		}
+	}
+}
+
+func Test_cacheScope(t *testing.T) {
+	repo := &drone.Repo{Slug: "octocat/hello-world"}
+	build := &drone.Build{Target: "master"}
+	untrusted := cacheScope(repo, build)
+	if got, want := untrusted, "octocat/hello-world:untrusted:master"; got != want {
+		t.Errorf("Want cache scope %q, got %q", want, got)
+	}
+	repo.Trusted = true
+	if cacheScope(repo, build) == untrusted {
+		t.Errorf("Want trusted and untrusted builds to use different cache scopes")
+	}
+	build.Target = "develop"
+	if cacheScope(repo, build) == cacheScope(repo, &drone.Build{Target: "master"}) {
+		t.Errorf("Want each branch to use a different cache scope")
+	}
+}
+
+func Test_proxyRepos(t *testing.T) {
+	tests := []struct {
+		settings map[string]*manifest.Parameter
+		want     []string
+	}{
+		{settings: nil, want: nil},
+		{
+			settings: map[string]*manifest.Parameter{"repo": {Value: "octocat/hello-world"}},
+			want:     []string{"octocat/hello-world"},
+		},
+		{
+			settings: map[string]*manifest.Parameter{"repo": {Value: []interface{}{"octocat/hello-world", "octocat/hola-mundo"}}},
+			want:     []string{"octocat/hello-world", "octocat/hola-mundo"},
+		},
+		{
+			settings: map[string]*manifest.Parameter{"repo": {Secret: "docker_repo"}},
+			want:     nil,
+		},
+	}
+	for _, test := range tests {
+		got := proxyRepos(&resource.Step{Settings: test.settings})
+		if diff := cmp.Diff(test.want, got); diff != "" {
+			t.Errorf(diff)
+		}
+	}
+}
+
+func Test_applyUlimits(t *testing.T) {
+	runner := []*engine.Ulimit{
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	}
+	step := []*engine.Ulimit{
+		{Name: "core", Soft: -1, Hard: -1},
+		{Name: "nofile", Soft: 4096, Hard: 4096},
+	}
+	got := applyUlimits(step, runner, false)
+	want := []*engine.Ulimit{
+		{Name: "core", Soft: -1, Hard: -1},
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+}
+
+func Test_applyHardening(t *testing.T) {
+	step := &engine.Step{
+		CapAdd:      []string{"NET_ADMIN"},
+		Privileged:  true,
+		PidsLimit:   1024,
+		SecurityOpt: []string{"no-new-privileges"},
+	}
+	applyHardening(step, Hardening{
+		Enabled:   true,
+		CapAdd:    []string{"CHOWN", "SETUID", "SETGID"},
+		PidsLimit: 256,
+		Seccomp:   `{"defaultAction":"SCMP_ACT_ERRNO"}`,
+	})
+	want := &engine.Step{
+		CapAdd:     []string{"CHOWN", "SETUID", "SETGID"},
+		CapDrop:    []string{"ALL"},
+		NoNewPrivs: true,
+		PidsLimit:  256,
+		SecurityOpt: []string{
+			"no-new-privileges",
+			`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`,
+		},
+	}
+	if diff := cmp.Diff(step, want); diff != "" {
+		t.Errorf(diff)
+	}
+}
@@ -55,6 +55,49 @@ func setupWorkdir(src *resource.Step, dst *engine.Step, path string) {
 	dst.WorkingDir = path
 }
 
+// helper function resolves the step artifact paths relative
+// to the workspace, and sets the directory the artifacts are
+// exported to.
+func setupArtifacts(step *engine.Step, full, dir string) {
+	if step.Artifacts == nil {
+		return
+	}
+	for i, path := range step.Artifacts.Paths {
+		if !stdpath.IsAbs(path) {
+			step.Artifacts.Paths[i] = stdpath.Join(full, path)
+		}
+	}
+	step.Artifacts.Workspace = full
+	step.Artifacts.Dir = dir
+}
+
+// helper function sets the path of the file the step writes
+// its outputs to. The file is created in the workspace volume
+// and the path is exposed to the step as DRONE_OUTPUT.
+func setupOutput(step *engine.Step, base, os string) {
+	name := ".drone_output_" + step.ID
+	if os == "windows" {
+		step.Output = base + "\\" + name
+	} else {
+		step.Output = stdpath.Join(base, name)
+	}
+	step.Envs["DRONE_OUTPUT"] = step.Output
+}
+
+// helper function sets the path of the file the step appends
+// environment variables to. The variables are merged into the
+// environment of later steps, and the path is exposed to the
+// step as DRONE_ENV.
+func setupEnvFile(step *engine.Step, base, os string) {
+	name := ".drone_env_" + step.ID
+	if os == "windows" {
+		step.EnvFile = base + "\\" + name
+	} else {
+		step.EnvFile = stdpath.Join(base, name)
+	}
+	step.Envs["DRONE_ENV"] = step.EnvFile
+}
+
 // helper function appends the workspace base and
 // path to the step's list of environment variables.
 func setupWorkspaceEnv(step *engine.Step, base, path, full string) {
@@ -0,0 +1,86 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"strings"
+
+	"github.com/drone-runners/drone-runner-docker/internal/expr"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+// step status reported in the step result, and referenced by
+// step expressions. Steps that have not run report an empty
+// status.
+const (
+	statusSuccess = "success"
+	statusFailure = "failure"
+	statusSkipped = "skipped"
+)
+
+// helper function evaluates the step expression, and returns
+// false if the step should be skipped. The expression can
+// reference the step environment, and the outputs and status
+// of other steps.
+func (s *Spec) matchExpr(step *Step) (bool, error) {
+	if step.Expr == "" {
+		return true, nil
+	}
+	x, err := expr.Parse(step.Expr)
+	if err != nil {
+		return false, err
+	}
+	return x.Eval(func(name string) string {
+		return s.resolve(step, name)
+	}), nil
+}
+
+// helper function resolves the named expression variable.
+func (s *Spec) resolve(step *Step, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := strings.SplitN(name, ".", 4)
+	switch {
+	case parts[0] == "env":
+		// the environment file variables are merged into the
+		// step environment when the container is created.
+		if v, ok := s.envs[parts[1]]; ok && step.EnvFile != "" {
+			return v
+		}
+		return step.Envs[parts[1]]
+	case parts[0] == "steps" && parts[2] == "status":
+		for _, other := range s.Steps {
+			if result, ok := s.results[other.ID]; ok && other.Name == parts[1] {
+				return result.Status
+			}
+		}
+	case parts[0] == "steps" && parts[2] == "outputs":
+		// secret outputs cannot be referenced, since the
+		// expression result would reveal the secret value.
+		for _, out := range s.outputs[parts[1]] {
+			if out.name == parts[3] && !out.secret {
+				return out.value
+			}
+		}
+	}
+	return ""
+}
+
+// helper function sets the step status.
+func (s *Spec) setStatus(step *Step, status string) {
+	s.updateResult(step, func(result *Result) {
+		result.Status = status
+	})
+}
+
+// helper function returns the step status for the exited
+// container state.
+func exitStatus(state *runtime.State) string {
+	if state.ExitCode != 0 || state.OOMKilled {
+		return statusFailure
+	}
+	return statusSuccess
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestMatchExpr(t *testing.T) {
+	build := &Step{ID: "1", Name: "build"}
+	test := &Step{ID: "2", Name: "test"}
+	spec := &Spec{
+		Steps: []*Step{build, test},
+		envs:  map[string]string{"VERSION": "1.2.3"},
+	}
+	spec.setStatus(test, statusFailure)
+	spec.setOutputs(build, []*output{
+		{name: "TAG", value: "latest"},
+		{name: "TOKEN", value: "secret", secret: true},
+	})
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"steps.test.status == 'failure' && env.DRONE_BRANCH == 'main'", true},
+		{"steps.test.status == 'success'", false},
+		{"steps.build.status == ''", true},
+		{"steps.build.outputs.TAG == 'latest'", true},
+		{"steps.build.outputs.TOKEN == 'secret'", false},
+		{"env.VERSION == '1.2.3'", true},
+	}
+	for _, test := range tests {
+		step := &Step{
+			Name:    "notify",
+			Expr:    test.expr,
+			EnvFile: "/drone/src/.drone_env_notify",
+			Envs:    map[string]string{"DRONE_BRANCH": "main"},
+		}
+		match, err := spec.matchExpr(step)
+		if err != nil {
+			t.Error(err)
+		}
+		if got, want := match, test.match; got != want {
+			t.Errorf("Want %q evaluated %v, got %v", test.expr, want, got)
+		}
+	}
+}
+
+func TestRun_Expr(t *testing.T) {
+	engine := New(new(fakeClient), Opts{})
+	step := &Step{
+		ID:   "1",
+		Name: "notify",
+		Expr: "env.DRONE_BRANCH == 'main'",
+		Envs: map[string]string{"DRONE_BRANCH": "develop"},
+	}
+	spec := &Spec{Steps: []*Step{step}}
+
+	output := new(bytes.Buffer)
+	state, err := engine.Run(context.Background(), spec, step, output)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if state.ExitCode != 0 {
+		t.Errorf("Expect skipped step exit code 0, got %d", state.ExitCode)
+	}
+	if got, want := output.String(), "skipping step: expression is false: env.DRONE_BRANCH == 'main'\n"; got != want {
+		t.Errorf("Want output %q, got %q", want, got)
+	}
+	if got, want := spec.Results()[0].Status, statusSkipped; got != want {
+		t.Errorf("Want step status %q, got %q", want, got)
+	}
+}
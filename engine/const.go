@@ -7,6 +7,11 @@ package engine
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // PullPolicy defines the container image pull policy.
@@ -18,6 +23,7 @@ const (
 	PullAlways
 	PullIfNotExists
 	PullNever
+	PullIfOlderThan
 )
 
 func (p PullPolicy) String() string {
@@ -29,6 +35,7 @@ var pullPolicyID = map[PullPolicy]string{
 	PullAlways:      "always",
 	PullIfNotExists: "if-not-exists",
 	PullNever:       "never",
+	PullIfOlderThan: "if-older-than",
 }
 
 var pullPolicyName = map[string]PullPolicy{
@@ -37,6 +44,63 @@ var pullPolicyName = map[string]PullPolicy{
 	"always":        PullAlways,
 	"if-not-exists": PullIfNotExists,
 	"never":         PullNever,
+	"if-older-than": PullIfOlderThan,
+}
+
+// ParsePullPolicy parses the string representation of the
+// pull policy. The if-older-than policy is followed by the
+// maximum age of the local image (eg. "if-older-than 24h"),
+// which is returned with the policy. An error is returned
+// if the policy is unknown or the maximum age is invalid.
+func ParsePullPolicy(s string) (PullPolicy, time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasPrefix(s, "if-older-than") {
+		age, err := time.ParseDuration(
+			strings.TrimSpace(
+				strings.TrimPrefix(s, "if-older-than"),
+			),
+		)
+		if err != nil || age <= 0 {
+			return PullDefault, 0, fmt.Errorf("invalid pull policy: %s", s)
+		}
+		return PullIfOlderThan, age, nil
+	}
+	policy, ok := pullPolicyName[s]
+	if !ok {
+		return PullDefault, 0, fmt.Errorf("invalid pull policy: %s", s)
+	}
+	return policy, 0, nil
+}
+
+// ParseUlimits parses the ulimits from a map of ulimit names
+// to limits. The limit is a single value used for both the
+// soft and hard limits, or a soft and hard limit separated by
+// a colon (eg. "1024:2048").
+func ParseUlimits(m map[string]string) ([]*Ulimit, error) {
+	var ulimits []*Ulimit
+	for name, s := range m {
+		parts := strings.SplitN(s, ":", 2)
+		soft, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ulimit %s: %s", name, s)
+		}
+		hard := soft
+		if len(parts) == 2 {
+			hard, err = strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ulimit %s: %s", name, s)
+			}
+		}
+		ulimits = append(ulimits, &Ulimit{
+			Name: name,
+			Soft: soft,
+			Hard: hard,
+		})
+	}
+	sort.Slice(ulimits, func(i, j int) bool {
+		return ulimits[i].Name < ulimits[j].Name
+	})
+	return ulimits, nil
 }
 
 // MarshalJSON marshals the string representation of the
@@ -8,6 +8,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestPullPolicy_Marshal(t *testing.T) {
@@ -31,6 +34,10 @@ func TestPullPolicy_Marshal(t *testing.T) {
 			policy: PullNever,
 			data:   `"never"`,
 		},
+		{
+			policy: PullIfOlderThan,
+			data:   `"if-older-than"`,
+		},
 	}
 	for _, test := range tests {
 		data, err := json.Marshal(&test.policy)
@@ -65,6 +72,10 @@ func TestPullPolicy_Unmarshal(t *testing.T) {
 			policy: PullNever,
 			data:   `"never"`,
 		},
+		{
+			policy: PullIfOlderThan,
+			data:   `"if-older-than"`,
+		},
 		{
 			// no policy should default to on-success
 			policy: PullDefault,
@@ -113,6 +124,10 @@ func TestPullPolicy_String(t *testing.T) {
 			policy: PullNever,
 			value:  "never",
 		},
+		{
+			policy: PullIfOlderThan,
+			value:  "if-older-than",
+		},
 	}
 	for _, test := range tests {
 		if got, want := test.policy.String(), test.value; got != want {
@@ -120,3 +135,59 @@ func TestPullPolicy_String(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePullPolicy(t *testing.T) {
+	tests := []struct {
+		value  string
+		policy PullPolicy
+		maxAge time.Duration
+		err    bool
+	}{
+		{value: "", policy: PullDefault},
+		{value: "always", policy: PullAlways},
+		{value: "If-Not-Exists", policy: PullIfNotExists},
+		{value: "never", policy: PullNever},
+		{value: "if-older-than 24h", policy: PullIfOlderThan, maxAge: time.Hour * 24},
+		{value: "if-older-than  90m ", policy: PullIfOlderThan, maxAge: time.Minute * 90},
+		{value: "if-older-than", err: true},
+		{value: "if-older-than yesterday", err: true},
+		{value: "if-older-than 1day", err: true},
+		{value: "if-older-than -1h", err: true},
+		{value: "sometimes", err: true},
+	}
+	for _, test := range tests {
+		policy, maxAge, err := ParsePullPolicy(test.value)
+		if got, want := err != nil, test.err; got != want {
+			t.Errorf("Want error %v for %q, got %v", want, test.value, err)
+			continue
+		}
+		if got, want := policy, test.policy; got != want {
+			t.Errorf("Want policy %q for %q, got %q", want, test.value, got)
+		}
+		if got, want := maxAge, test.maxAge; got != want {
+			t.Errorf("Want max age %s for %q, got %s", want, test.value, got)
+		}
+	}
+}
+
+func TestParseUlimits(t *testing.T) {
+	got, err := ParseUlimits(map[string]string{
+		"nproc":  "512",
+		"nofile": "1024:2048",
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	want := []*Ulimit{
+		{Name: "nofile", Soft: 1024, Hard: 2048},
+		{Name: "nproc", Soft: 512, Hard: 512},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf(diff)
+	}
+
+	if _, err := ParseUlimits(map[string]string{"nofile": "unlimited"}); err == nil {
+		t.Errorf("Expect error when ulimit is invalid")
+	}
+}
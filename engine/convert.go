@@ -10,8 +10,35 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-units"
 )
 
+// labelDigest is the container label used to record the
+// digest of the step image.
+const labelDigest = "io.drone.step.image.digest"
+
+// helper function adds the image digest to the container
+// labels. The labels are copied to avoid modifying the step.
+func withDigest(config *container.Config, digest string) *container.Config {
+	if digest == "" {
+		return config
+	}
+	labels := map[string]string{}
+	for k, v := range config.Labels {
+		labels[k] = v
+	}
+	labels[labelDigest] = digest
+	config.Labels = labels
+	return config
+}
+
+// helper function appends the mounts to the container host
+// configuration.
+func withMounts(config *container.HostConfig, mounts []mount.Mount) *container.HostConfig {
+	config.Mounts = append(config.Mounts, mounts...)
+	return config
+}
+
 // returns a container configuration.
 func toConfig(spec *Spec, step *Step) *container.Config {
 	config := &container.Config{
@@ -46,6 +73,9 @@ func toConfig(spec *Spec, step *Step) *container.Config {
 	if len(step.Volumes) != 0 {
 		config.Volumes = toVolumeSet(spec, step)
 	}
+	if step.StopSignal != "" {
+		config.StopSignal = step.StopSignal
+	}
 	return config
 }
 
@@ -75,6 +105,22 @@ func toHostConfig(spec *Spec, step *Step) *container.HostConfig {
 	if len(step.ExtraHosts) > 0 {
 		config.ExtraHosts = step.ExtraHosts
 	}
+	if len(step.CapAdd) > 0 {
+		config.CapAdd = step.CapAdd
+	}
+	if len(step.CapDrop) > 0 {
+		config.CapDrop = step.CapDrop
+	}
+	if len(step.SecurityOpt) > 0 {
+		config.SecurityOpt = step.SecurityOpt
+	}
+	if step.NoNewPrivs {
+		config.SecurityOpt = append(config.SecurityOpt, "no-new-privileges")
+	}
+	config.ReadonlyRootfs = step.ReadOnly
+	if step.Runtime != "" {
+		config.Runtime = step.Runtime
+	}
 	if isUnlimited(step) == false {
 		config.Resources = container.Resources{
 			CPUPeriod:  step.CPUPeriod,
@@ -83,8 +129,15 @@ func toHostConfig(spec *Spec, step *Step) *container.HostConfig {
 			CPUShares:  step.CPUShares,
 			Memory:     step.MemLimit,
 			MemorySwap: step.MemSwapLimit,
+			Ulimits:    toUlimits(step.Ulimits),
+		}
+		if step.PidsLimit != 0 {
+			config.Resources.PidsLimit = &step.PidsLimit
 		}
 	}
+	if len(step.Sysctls) > 0 {
+		config.Sysctls = step.Sysctls
+	}
 
 	if len(step.Volumes) != 0 {
 		config.Devices = toDeviceSlice(spec, step)
@@ -261,6 +314,19 @@ func toEnv(env map[string]string) []string {
 	return envs
 }
 
+// helper function converts the ulimits to docker ulimits.
+func toUlimits(from []*Ulimit) []*units.Ulimit {
+	var to []*units.Ulimit
+	for _, ulimit := range from {
+		to = append(to, &units.Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+	return to
+}
+
 // returns true if the container has no resource limits.
 func isUnlimited(res *Step) bool {
 	return len(res.CPUSet) == 0 &&
@@ -268,7 +334,9 @@ func isUnlimited(res *Step) bool {
 		res.CPUQuota == 0 &&
 		res.CPUShares == 0 &&
 		res.MemLimit == 0 &&
-		res.MemSwapLimit == 0
+		res.MemSwapLimit == 0 &&
+		res.PidsLimit == 0 &&
+		len(res.Ulimits) == 0
 }
 
 // returns true if the volume is a bind mount.
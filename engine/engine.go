@@ -6,43 +6,103 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/drone-runners/drone-runner-docker/internal/docker/errors"
 	"github.com/drone-runners/drone-runner-docker/internal/docker/image"
-	"github.com/drone-runners/drone-runner-docker/internal/docker/jsonmessage"
 	"github.com/drone-runners/drone-runner-docker/internal/docker/stdcopy"
 	"github.com/drone/runner-go/logger"
 	"github.com/drone/runner-go/pipeline/runtime"
-	"github.com/drone/runner-go/registry/auths"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/errdefs"
 )
 
+// stopTimeout is the default grace period given to a container
+// to exit after it is stopped, before it is forcibly killed.
+const stopTimeout = time.Second * 10
+
+// LabelProxy is the image label used to identify the images
+// built through the docker socket proxy. The label value is
+// unique to the pipeline stage.
+const LabelProxy = "io.drone.proxy"
+
 // Opts configures the Docker engine.
 type Opts struct {
 	HidePull bool
+
+	// PullConcurrency limits the number of images pulled
+	// concurrently during setup. If zero, images are not
+	// pulled during setup and are instead pulled before
+	// each step executes. Note that the pipeline setup is
+	// not cancelled when the build is cancelled, and the
+	// pulls cannot be interrupted.
+	PullConcurrency int
+
+	// PullRetries is the number of times an image pull is
+	// retried when it fails with a transient error.
+	PullRetries int
+
+	// PullRecord is the path of the file used to record
+	// when each image was last pulled. If empty, the record
+	// is kept in memory.
+	PullRecord string
+
+	// CacheMaxSize is the maximum total size of the cache
+	// volumes, in bytes. When exceeded, the least recently
+	// used caches are evicted. If zero, caches are never
+	// evicted.
+	CacheMaxSize int64
+
+	// CacheRecord is the path of the file used to record
+	// when each cache was last used. If empty, the record
+	// is kept in memory.
+	CacheRecord string
+
+	// ArtifactDir is the host directory that step artifacts
+	// are exported to. If empty, artifacts are not exported.
+	ArtifactDir string
 }
 
 // Docker implements a Docker pipeline engine.
 type Docker struct {
-	client   client.APIClient
-	hidePull bool
+	client          client.APIClient
+	hidePull        bool
+	pullConcurrency int
+	pullRetries     int
+	history         *timeRecord
+	artifactDir     string
+	caches          *timeRecord
+	cacheMaxSize    int64
+
+	monitor *exitMonitor
+
+	mu      sync.Mutex
+	tracked map[*Spec]struct{}
 }
 
 // New returns a new engine.
 func New(client client.APIClient, opts Opts) *Docker {
 	return &Docker{
-		client:   client,
-		hidePull: opts.HidePull,
+		client:          client,
+		hidePull:        opts.HidePull,
+		pullConcurrency: opts.PullConcurrency,
+		pullRetries:     opts.PullRetries,
+		history:         newTimeRecord(opts.PullRecord),
+		artifactDir:     opts.ArtifactDir,
+		caches:          newTimeRecord(opts.CacheRecord),
+		cacheMaxSize:    opts.CacheMaxSize,
+		monitor:         newExitMonitor(client),
 	}
 }
 
@@ -65,6 +125,18 @@ func (e *Docker) Ping(ctx context.Context) error {
 func (e *Docker) Setup(ctx context.Context, specv runtime.Spec) error {
 	spec := specv.(*Spec)
 
+	// tracks the pipeline resources, which prevents the
+	// resources from being reclaimed as orphans.
+	e.track(spec)
+
+	// subscribes to the container events, which are used
+	// to detect when containers exit.
+	e.monitor.start()
+
+	// creates the readiness gates that block steps until
+	// the services they depend on are ready.
+	spec.createGates()
+
 	// creates the default temporary (local) volumes
 	// that are mounted into each container step.
 	for _, vol := range spec.Volumes {
@@ -93,6 +165,12 @@ func (e *Docker) Setup(ctx context.Context, specv runtime.Spec) error {
 		Labels:  spec.Network.Labels,
 	})
 
+	// pulls the pipeline images concurrently, instead of
+	// pulling each image before the step executes.
+	if e.pullConcurrency > 0 {
+		e.prepull(ctx, spec)
+	}
+
 	// launches the inernal setup steps
 	for _, step := range spec.Internal {
 		if err := e.create(ctx, spec, step, ioutil.Discard); err != nil {
@@ -109,6 +187,18 @@ func (e *Docker) Setup(ctx context.Context, specv runtime.Spec) error {
 				Errorln("cannot start tmate container")
 			return err
 		}
+		if step.Detach && step.Ready != nil {
+			// the detached internal containers, such as the
+			// docker socket proxy, must be ready before the
+			// pipeline steps are started.
+			if err := e.awaitReady(ctx, spec, step, nil, ioutil.Discard); err != nil {
+				logger.FromContext(ctx).
+					WithError(err).
+					WithField("container", step.ID).
+					Errorln("internal container is not ready")
+				return err
+			}
+		}
 		if !step.Detach {
 			// the internal containers perform short-lived tasks
 			// and should not require > 1 minute to execute.
@@ -129,13 +219,43 @@ func (e *Docker) Setup(ctx context.Context, specv runtime.Spec) error {
 func (e *Docker) Destroy(ctx context.Context, specv runtime.Spec) error {
 	spec := specv.(*Spec)
 
+	// the containers are about to be stopped, which must not
+	// be reported as unexpected exits.
+	spec.stop()
+
 	removeOpts := types.ContainerRemoveOptions{
 		Force:         true,
 		RemoveLinks:   false,
 		RemoveVolumes: true,
 	}
 
-	// stop all containers
+	// if the pipeline was cancelled or timed out, stop all
+	// containers in reverse dependency order. each container
+	// is sent the stop signal, and is killed if it does not
+	// exit within the grace period.
+	if spec.interrupted() {
+		for _, group := range stopOrder(spec.Steps) {
+			var wg sync.WaitGroup
+			for _, step := range group {
+				wg.Add(1)
+				go func(step *Step) {
+					defer wg.Done()
+					if err := e.stop(ctx, step); err != nil && !errdefs.IsConflict(err) {
+						logger.FromContext(ctx).
+							WithError(err).
+							WithField("container", step.ID).
+							Debugln("cannot stop container")
+					}
+				}(step)
+			}
+			wg.Wait()
+		}
+	}
+
+	// kill the remaining containers, which includes the
+	// services of a pipeline that completed, and the internal
+	// containers, which perform short-lived tasks and do not
+	// require a graceful shutdown.
 	for _, step := range append(spec.Steps, spec.Internal...) {
 		if err := e.client.ContainerKill(ctx, step.ID, "9"); err != nil && !client.IsErrNotFound(err) && !errdefs.IsConflict(err) {
 			logger.FromContext(ctx).
@@ -145,8 +265,13 @@ func (e *Docker) Destroy(ctx context.Context, specv runtime.Spec) error {
 		}
 	}
 
-	// cleanup all containers
-	for _, step := range append(spec.Steps, spec.Internal...) {
+	// cleanup all containers, including the internal diff
+	// container, which is only created if used.
+	steps := append(spec.Steps, spec.Internal...)
+	if spec.Diff != nil {
+		steps = append(steps, spec.Diff)
+	}
+	for _, step := range steps {
 		if err := e.client.ContainerRemove(ctx, step.ID, removeOpts); err != nil && !client.IsErrNotFound(err) {
 			logger.FromContext(ctx).
 				WithError(err).
@@ -155,6 +280,19 @@ func (e *Docker) Destroy(ctx context.Context, specv runtime.Spec) error {
 		}
 	}
 
+	// remove the images built through the docker socket
+	// proxy, which are identified by the proxy label.
+	for _, step := range spec.Internal {
+		if value, ok := step.Labels[LabelProxy]; ok {
+			e.removeImages(ctx, LabelProxy+"="+value)
+		}
+	}
+
+	// save or discard the caches, which are persisted
+	// across pipelines and are not removed with the
+	// pipeline volumes.
+	e.saveCaches(ctx, spec)
+
 	// cleanup all volumes
 	for _, vol := range spec.Volumes {
 		if vol.EmptyDir == nil {
@@ -182,9 +320,10 @@ func (e *Docker) Destroy(ctx context.Context, specv runtime.Spec) error {
 	}
 
 	// notice that we never collect or return any errors.
-	// this is because we silently ignore cleanup failures
-	// and instead ask the system admin to periodically run
-	// `docker prune` commands.
+	// this is because we silently ignore cleanup failures.
+	// resources that cannot be removed are no longer tracked
+	// and are eventually reclaimed by the janitor.
+	e.untrack(spec)
 	return nil
 }
 
@@ -193,16 +332,176 @@ func (e *Docker) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 	spec := specv.(*Spec)
 	step := stepv.(*Step)
 
+	// record that the pipeline was cancelled or timed out,
+	// in which case the containers are stopped gracefully
+	// when the pipeline is destroyed.
+	defer func() {
+		if ctx.Err() != nil {
+			spec.interrupt()
+		}
+	}()
+
+	// mark the service as started. the steps that depend on
+	// the service wait for the service to start, since the
+	// service is never started if it is skipped.
+	if g, ok := spec.gate(step.Name); ok {
+		g.markStarted()
+	}
+
+	// skip the step if none of the files changed by the build
+	// match the step path conditions.
+	match, err := e.matchPaths(ctx, spec, step)
+	if err != nil {
+		fmt.Fprintf(output, "%s, ignoring paths condition\n", err)
+	}
+	if !match {
+		return skip(spec, step, output, "no changed files match the paths condition")
+	}
+
+	// skip the step if the step expression evaluates to false.
+	match, err = spec.matchExpr(step)
+	if err != nil {
+		err = fmt.Errorf("invalid expression: %s", err)
+		if g, ok := spec.gate(step.Name); ok {
+			g.release(err)
+		}
+		spec.setStatus(step, statusFailure)
+		return nil, err
+	}
+	if !match {
+		return skip(spec, step, output, "expression is false: "+step.Expr)
+	}
+
+	// block until the services this step depends on are
+	// ready, failing the step if a service is not ready.
+	if err := e.waitReady(ctx, spec, step); err != nil {
+		spec.setStatus(step, statusFailure)
+		return nil, err
+	}
+
+	// inject the outputs published by the steps this step
+	// depends on, masking the secret outputs in the logs.
+	output = spec.injectOutputs(step, output)
+	if m, ok := output.(*maskWriter); ok {
+		defer m.Flush()
+	}
+
+	// steps without a retry policy are attempted exactly once.
+	attempts := 1
+	if step.Retry != nil && step.Retry.Attempts > 1 {
+		attempts = step.Retry.Attempts
+	}
+
+	var delay time.Duration
+	if step.Retry != nil {
+		delay = step.Retry.Delay
+	}
+
+	// fail records the step failure. if the service cannot be
+	// started, the steps waiting for the service must be
+	// unblocked.
+	fail := func(err error) (*runtime.State, error) {
+		spec.failCaches(step)
+		spec.setStatus(step, statusFailure)
+		if g, ok := spec.gate(step.Name); ok {
+			g.release(err)
+		}
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		state, err := e.run(ctx, spec, step, output)
+		spec.updateResult(step, func(result *Result) {
+			result.Attempts = attempt
+		})
+		if err != nil {
+			return fail(err)
+		}
+		if attempt >= attempts || !shouldRetry(step.Retry, state) {
+			if state.ExitCode != 0 {
+				spec.failCaches(step)
+			}
+			spec.setStatus(step, exitStatus(state))
+			return state, nil
+		}
+
+		fmt.Fprintf(output, "step exited with code %d, retrying (attempt %d/%d) in %s\n", state.ExitCode, attempt+1, attempts, delay)
+		select {
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		case <-time.After(delay):
+		}
+		if step.Retry.Backoff > 1 {
+			delay = time.Duration(float64(delay) * step.Retry.Backoff)
+		}
+
+		// each attempt runs in a fresh container, so we remove
+		// the exited container before it is re-created.
+		if err := e.remove(ctx, step.ID); err != nil {
+			return fail(errors.TrimExtraInfo(err))
+		}
+	}
+}
+
+// helper function skips the step, writing the reason to the
+// step logs. The steps waiting for a skipped service must be
+// unblocked.
+//
+// The runtime cannot skip a step once the step has started,
+// which means a skipped step exits with code 0 and is reported
+// to the server as passing. A skipped step is identified by the
+// "skipping step: <reason>" log line, and by the "skipped"
+// result status, which is included in the pipeline dump and
+// can be referenced by step expressions.
+func skip(spec *Spec, step *Step, output io.Writer, reason string) (*runtime.State, error) {
+	if g, ok := spec.gate(step.Name); ok {
+		g.release(errServiceSkipped)
+	}
+	spec.setStatus(step, statusSkipped)
+	fmt.Fprintf(output, "skipping step: %s\n", reason)
+	return &runtime.State{Exited: true}, nil
+}
+
+// helper function runs a single attempt of the pipeline step.
+func (e *Docker) run(ctx context.Context, spec *Spec, step *Step, output io.Writer) (*runtime.State, error) {
 	// create the container
 	err := e.create(ctx, spec, step, output)
 	if err != nil {
 		return nil, errors.TrimExtraInfo(err)
 	}
+	// watch the container for lifecycle events. the watch is
+	// registered before the container starts, otherwise the
+	// container could exit before the watch is registered.
+	exit := e.monitor.watch(step.ID)
+	defer e.monitor.unwatch(step.ID, exit)
 	// start the container
 	err = e.start(ctx, step.ID)
 	if err != nil {
 		return nil, errors.TrimExtraInfo(err)
 	}
+	// sample the container stats while the step runs.
+	stats := e.collect(ctx, step.ID)
+	defer stats.cancel()
+	// probe the service in the background, releasing the
+	// dependent steps once the service is ready.
+	if step.Detach && step.Ready != nil {
+		go e.probe(ctx, spec, step, exit.done, output)
+	}
+	// stop the container if the step exceeds its timeout. the
+	// pipeline context is not cancelled, which allows the
+	// remaining steps to execute.
+	var timer *time.Timer
+	if step.Timeout > 0 {
+		timer = time.AfterFunc(step.Timeout, func() {
+			if err := e.stop(ctx, step); err != nil {
+				logger.FromContext(ctx).
+					WithError(err).
+					WithField("container", step.ID).
+					Debugln("cannot stop container")
+			}
+		})
+		defer timer.Stop()
+	}
 	// this is an experimental feature that closes logging as the last step
 	var allowDeferTailLog = os.Getenv("DRONE_DEFER_TAIL_LOG") == "true"
 	if allowDeferTailLog {
@@ -222,7 +521,58 @@ func (e *Docker) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 		}
 	}
 	// wait for the response
-	return e.waitRetry(ctx, step.ID)
+	state, err := e.waitExit(ctx, step.ID, exit)
+	if err != nil {
+		return nil, err
+	}
+	// if the timer already fired, the step exceeded its timeout
+	// and is reported as killed, regardless of how the container
+	// exited once stopped.
+	oom, signal := exit.status()
+	switch {
+	case timer != nil && !timer.Stop():
+		fmt.Fprintf(output, "step timed out after %s\n", step.Timeout)
+		state.ExitCode = 137
+	case spec.stopping():
+		// the container was stopped by the runner because
+		// the pipeline is complete or was cancelled.
+	case oom:
+		fmt.Fprintf(output, "step was killed after running out of memory\n")
+	case signal != "":
+		fmt.Fprintf(output, "step was killed by signal %s\n", signal)
+	}
+	// detached services are expected to run until the pipeline
+	// is complete, so an earlier exit is reported.
+	if step.Detach && !spec.stopping() {
+		fmt.Fprintf(output, "service exited unexpectedly with exit code %d\n", state.ExitCode)
+		logger.FromContext(ctx).
+			WithField("container", step.ID).
+			WithField("service", step.Name).
+			WithField("exit code", state.ExitCode).
+			Warnln("service exited unexpectedly")
+	}
+	spec.updateResult(step, func(result *Result) {
+		result.OOMKilled = state.OOMKilled
+		result.Signal = signal
+	})
+	// copy the artifacts out of the exited container, which
+	// are exported regardless of the step exit code.
+	if artifacts := e.export(ctx, step, output); len(artifacts) != 0 {
+		spec.updateResult(step, func(result *Result) {
+			result.Artifacts = artifacts
+		})
+	}
+	// read the outputs published by the step, which are
+	// injected into the steps that depend on this step.
+	e.collectOutputs(ctx, spec, step, output)
+	e.collectEnvFile(ctx, spec, step, output)
+	if usage := stats.stop(); usage != nil {
+		fmt.Fprintf(output, "resource usage: %s\n", usage)
+		spec.updateResult(step, func(result *Result) {
+			result.Usage = usage
+		})
+	}
+	return state, nil
 }
 
 //
@@ -230,36 +580,54 @@ func (e *Docker) Run(ctx context.Context, specv runtime.Spec, stepv runtime.Step
 //
 
 func (e *Docker) create(ctx context.Context, spec *Spec, step *Step, output io.Writer) error {
-	// create pull options with encoded authorization credentials.
-	pullopts := types.ImagePullOptions{}
-	if step.Auth != nil {
-		pullopts.RegistryAuth = auths.Header(
-			step.Auth.Username,
-			step.Auth.Password,
-		)
+	// if the image was pulled during setup, the pull is not
+	// repeated and any pull error is reported by this step.
+	pulled, err := spec.pulled(step.Image, output)
+	if err != nil {
+		return err
+	}
+
+	// automatically pull the image if the local image is older
+	// than the maximum age defined by the pull policy.
+	var stale bool
+	if pulled && step.Pull == PullIfOlderThan {
+		fmt.Fprintf(output, "image %s was pulled during setup (pull policy: if-older-than %s)\n", step.Image, step.PullMaxAge)
+	} else if step.Pull == PullIfOlderThan {
+		age, ok := e.imageAge(ctx, step.Image)
+		switch {
+		case !ok:
+			fmt.Fprintf(output, "image %s has no recorded pull time, pulling image (pull policy: if-older-than %s)\n", step.Image, step.PullMaxAge)
+			stale = true
+		case age > step.PullMaxAge:
+			fmt.Fprintf(output, "image %s was pulled %s ago, pulling image (pull policy: if-older-than %s)\n", step.Image, age.Round(time.Second), step.PullMaxAge)
+			stale = true
+		default:
+			fmt.Fprintf(output, "image %s was pulled %s ago, skipping pull (pull policy: if-older-than %s)\n", step.Image, age.Round(time.Second), step.PullMaxAge)
+		}
 	}
 
 	// automatically pull the latest version of the image if requested
 	// by the process configuration, or if the image is :latest
-	if step.Pull == PullAlways ||
-		(step.Pull == PullDefault && image.IsLatest(step.Image)) {
-		rc, pullerr := e.client.ImagePull(ctx, step.Image, pullopts)
-		if pullerr == nil {
-			if e.hidePull {
-				io.Copy(ioutil.Discard, rc)
-			} else {
-				jsonmessage.Copy(rc, output)
-			}
-			rc.Close()
-		}
-		if pullerr != nil {
-			return pullerr
+	if !pulled && (step.Pull == PullAlways || stale ||
+		(step.Pull == PullDefault && image.IsLatest(step.Image))) {
+		if err := e.pull(ctx, step.Image, step.Auth, output); err != nil {
+			return err
 		}
 	}
 
-	_, err := e.client.ContainerCreate(ctx,
-		toConfig(spec, step),
-		toHostConfig(spec, step),
+	// restore the caches mounted by the step. the cache key
+	// is rendered once the image is available, since the key
+	// may reference files in the workspace.
+	caches := e.restoreCaches(ctx, spec, step, output)
+
+	// merge the environment variables written to the
+	// environment file by previous steps.
+	spec.mergeEnvFile(step)
+
+	digest := e.digest(ctx, step.Image)
+	_, err = e.client.ContainerCreate(ctx,
+		withDigest(toConfig(spec, step), digest),
+		withMounts(toHostConfig(spec, step), caches),
 		toNetConfig(spec, step),
 		step.ID,
 	)
@@ -267,23 +635,16 @@ func (e *Docker) create(ctx context.Context, spec *Spec, step *Step, output io.W
 	// automatically pull and try to re-create the image if the
 	// failure is caused because the image does not exist.
 	if client.IsErrNotFound(err) && step.Pull != PullNever {
-		rc, pullerr := e.client.ImagePull(ctx, step.Image, pullopts)
-		if pullerr != nil {
-			return pullerr
-		}
-
-		if e.hidePull {
-			io.Copy(ioutil.Discard, rc)
-		} else {
-			jsonmessage.Copy(rc, output)
+		if err := e.pull(ctx, step.Image, step.Auth, output); err != nil {
+			return err
 		}
-		rc.Close()
 
 		// once the image is successfully pulled we attempt to
 		// re-create the container.
+		digest = e.digest(ctx, step.Image)
 		_, err = e.client.ContainerCreate(ctx,
-			toConfig(spec, step),
-			toHostConfig(spec, step),
+			withDigest(toConfig(spec, step), digest),
+			withMounts(toHostConfig(spec, step), caches),
 			toNetConfig(spec, step),
 			step.ID,
 		)
@@ -292,6 +653,16 @@ func (e *Docker) create(ctx context.Context, spec *Spec, step *Step, output io.W
 		return err
 	}
 
+	// record the digest the image resolved to, so that the
+	// exact image used by the step can be audited.
+	if digest != "" {
+		fmt.Fprintf(output, "image %s resolved to %s\n", step.Image, digest)
+	}
+	spec.updateResult(step, func(result *Result) {
+		result.Image = step.Image
+		result.Digest = digest
+	})
+
 	// attach the container to user-defined networks.
 	// primarily used to attach global user-defined networks.
 	if step.Network == "" {
@@ -308,13 +679,149 @@ func (e *Docker) create(ctx context.Context, spec *Spec, step *Step, output io.W
 	return nil
 }
 
+// helper function emulates the `docker stop` command, sending
+// the stop signal and killing the container if it does not
+// exit within the grace period.
+func (e *Docker) stop(ctx context.Context, step *Step) error {
+	timeout := stopTimeout
+	if step.StopGrace > 0 {
+		timeout = step.StopGrace
+	}
+	err := e.client.ContainerStop(ctx, step.ID, &timeout)
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// helper function removes the images with the label,
+// including all image tags.
+func (e *Docker) removeImages(ctx context.Context, label string) {
+	args := filters.NewArgs()
+	args.Add("label", label)
+	images, err := e.client.ImageList(ctx, types.ImageListOptions{
+		Filters: args,
+	})
+	if err != nil {
+		logger.FromContext(ctx).
+			WithError(err).
+			WithField("label", label).
+			Debugln("cannot list images")
+		return
+	}
+	for _, image := range images {
+		_, err := e.client.ImageRemove(ctx, image.ID, types.ImageRemoveOptions{
+			Force:         true,
+			PruneChildren: true,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("image", image.ID).
+				Debugln("cannot remove image")
+		}
+	}
+}
+
+// helper function emulates the `docker rm -f` command.
+func (e *Docker) remove(ctx context.Context, id string) error {
+	err := e.client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// helper function returns the repository digest of the local
+// image. If the image was built locally and has no repository
+// digest, the image identifier is returned instead.
+func (e *Docker) digest(ctx context.Context, name string) string {
+	info, _, err := e.client.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return ""
+	}
+	if digest := image.Digest(name, info.RepoDigests...); digest != "" {
+		return digest
+	}
+	return info.ID
+}
+
+// helper function returns the age of the local image, based on
+// the time the image was last pulled by the runner. If the image
+// has no recorded pull time, the image metadata is used instead.
+func (e *Docker) imageAge(ctx context.Context, name string) (time.Duration, bool) {
+	if last, ok := e.history.Get(name); ok {
+		return time.Since(last), true
+	}
+	info, _, err := e.client.ImageInspectWithRaw(ctx, name)
+	if err != nil {
+		return 0, false
+	}
+	last := info.Metadata.LastTagTime
+	if last.IsZero() {
+		last, _ = time.Parse(time.RFC3339Nano, info.Created)
+	}
+	if last.IsZero() {
+		return 0, false
+	}
+	return time.Since(last), true
+}
+
 // helper function emulates the `docker start` command.
 func (e *Docker) start(ctx context.Context, id string) error {
 	return e.client.ContainerStart(ctx, id, types.ContainerStartOptions{})
 }
 
-// helper function emulates the `docker wait` command, blocking
-// until the container stops and returning the exit code.
+// helper function blocks until the container exits, as reported
+// by the docker events stream or the docker wait command,
+// and returns the exit code.
+func (e *Docker) waitExit(ctx context.Context, id string, exit *exitWatch) (*runtime.State, error) {
+	// the docker wait command races the events stream, since
+	// the exit event is missed if the events stream fails or
+	// is reconnecting when the container exits.
+	waitctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	waited := make(chan struct{})
+	go func() {
+		if _, err := e.waitRetry(waitctx, id); err == nil {
+			close(waited)
+		}
+	}()
+
+	// if the context is canceled, meaning the pipeline
+	// timed out or was killed by the end-user, we should
+	// exit with an error.
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-exit.done:
+	case <-waited:
+		// the exit event is usually received shortly after
+		// the wait returns, and reports whether the container
+		// was killed by a signal.
+		select {
+		case <-exit.done:
+		case <-time.After(time.Second):
+		}
+	}
+
+	info, err := e.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	oom, _ := exit.status()
+	return &runtime.State{
+		Exited:    true,
+		ExitCode:  info.State.ExitCode,
+		OOMKilled: info.State.OOMKilled || oom,
+	}, nil
+}
+
+// helper function emulates the `docker wait` command, retrying
+// until the container stops.
 func (e *Docker) waitRetry(ctx context.Context, id string) (*runtime.State, error) {
 	for {
 		// if the context is canceled, meaning the
@@ -0,0 +1,333 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// fakeClient is a Docker client that records the container
+// host configuration, and serves container files.
+type fakeClient struct {
+	client.APIClient
+
+	hostConfig *container.HostConfig
+	files      map[string]string
+	exitCode   int
+	started    []string
+	stopped    []string
+	killed     []string
+	images     []string
+	volumes    map[string]bool
+
+	// running, if not nil, blocks the container wait until
+	// the container is stopped.
+	running chan struct{}
+	stop    sync.Once
+}
+
+func (c *fakeClient) ContainerStop(ctx context.Context, id string, timeout *time.Duration) error {
+	c.stopped = append(c.stopped, id)
+	if c.running != nil {
+		c.stop.Do(func() { close(c.running) })
+	}
+	return nil
+}
+
+func (c *fakeClient) ContainerKill(ctx context.Context, id, signal string) error {
+	c.killed = append(c.killed, id)
+	return nil
+}
+
+func (c *fakeClient) ContainerRemove(ctx context.Context, id string, options types.ContainerRemoveOptions) error {
+	return nil
+}
+
+func (c *fakeClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	var images []types.ImageSummary
+	for _, id := range c.images {
+		images = append(images, types.ImageSummary{ID: id})
+	}
+	return images, nil
+}
+
+func (c *fakeClient) ImageRemove(ctx context.Context, id string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	for i, image := range c.images {
+		if image == id {
+			c.images = append(c.images[:i], c.images[i+1:]...)
+			break
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeClient) NetworkRemove(ctx context.Context, id string) error {
+	return nil
+}
+
+func (c *fakeClient) ContainerStats(ctx context.Context, id string, stream bool) (types.ContainerStats, error) {
+	return types.ContainerStats{}, errors.New("not supported")
+}
+
+func (c *fakeClient) ContainerLogs(ctx context.Context, id string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	return ioutil.NopCloser(new(bytes.Buffer)), nil
+}
+
+func (c *fakeClient) ContainerStart(ctx context.Context, id string, options types.ContainerStartOptions) error {
+	c.started = append(c.started, id)
+	return nil
+}
+
+func (c *fakeClient) ContainerWait(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
+	wait := make(chan container.ContainerWaitOKBody, 1)
+	go func() {
+		if c.running != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-c.running:
+			}
+		}
+		wait <- container.ContainerWaitOKBody{StatusCode: int64(c.exitCode)}
+	}()
+	return wait, make(chan error)
+}
+
+func (c *fakeClient) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			State: &types.ContainerState{ExitCode: c.exitCode},
+		},
+	}, nil
+}
+
+func (c *fakeClient) CopyFromContainer(ctx context.Context, id, path string) (io.ReadCloser, types.ContainerPathStat, error) {
+	data, ok := c.files[path]
+	if !ok {
+		return nil, types.ContainerPathStat{}, errdefs.NotFound(errors.New("not found"))
+	}
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	tw.WriteHeader(&tar.Header{
+		Name:     path,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	})
+	tw.Write([]byte(data))
+	tw.Close()
+	return ioutil.NopCloser(buf), types.ContainerPathStat{}, nil
+}
+
+func (c *fakeClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, name string) (container.ContainerCreateCreatedBody, error) {
+	c.hostConfig = hostConfig
+	return container.ContainerCreateCreatedBody{ID: name}, nil
+}
+
+func (c *fakeClient) VolumeInspect(ctx context.Context, id string) (types.Volume, error) {
+	if !c.volumes[id] {
+		return types.Volume{}, errdefs.NotFound(errors.New("not found"))
+	}
+	return types.Volume{Name: id}, nil
+}
+
+func (c *fakeClient) VolumeCreate(ctx context.Context, options volume.VolumeCreateBody) (types.Volume, error) {
+	if c.volumes == nil {
+		c.volumes = map[string]bool{}
+	}
+	c.volumes[options.Name] = true
+	return types.Volume{Name: options.Name}, nil
+}
+
+func (c *fakeClient) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	return types.ImageInspect{}, nil, errors.New("not found")
+}
+
+func TestCreate_Runtime(t *testing.T) {
+	fake := new(fakeClient)
+	engine := New(fake, Opts{})
+	spec := &Spec{Network: Network{ID: "drone-network"}}
+	step := &Step{
+		ID:      "drone-step",
+		Image:   "golang:1.14",
+		Pull:    PullIfNotExists,
+		Network: "host",
+		Runtime: "runsc",
+	}
+	if err := engine.create(context.Background(), spec, step, ioutil.Discard); err != nil {
+		t.Error(err)
+		return
+	}
+	if fake.hostConfig == nil {
+		t.Errorf("Expect container created")
+		return
+	}
+	if got, want := fake.hostConfig.Runtime, "runsc"; got != want {
+		t.Errorf("Want container runtime %q, got %q", want, got)
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	fake := &fakeClient{
+		exitCode: 143,
+		running:  make(chan struct{}),
+	}
+	engine := New(fake, Opts{})
+	step := &Step{
+		ID:      "drone-step",
+		Name:    "test",
+		Image:   "golang:1.14",
+		Pull:    PullIfNotExists,
+		Timeout: 50 * time.Millisecond,
+	}
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{step},
+	}
+
+	output := new(bytes.Buffer)
+	state, err := engine.Run(context.Background(), spec, step, output)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 137; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+	if !strings.Contains(output.String(), "step timed out after 50ms") {
+		t.Errorf("Expect timeout reported, got %q", output.String())
+	}
+	if len(fake.stopped) != 1 || fake.stopped[0] != step.ID {
+		t.Errorf("Expect container stopped, got %v", fake.stopped)
+	}
+}
+
+// This test verifies that the containers of a completed
+// pipeline are killed, and not stopped gracefully.
+func TestDestroy_Completed(t *testing.T) {
+	fake := new(fakeClient)
+	engine := New(fake, Opts{})
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{{ID: "drone-service", Name: "redis", Detach: true}},
+	}
+	engine.Destroy(context.Background(), spec)
+	if len(fake.stopped) != 0 {
+		t.Errorf("Expect containers not stopped, got %v", fake.stopped)
+	}
+	if len(fake.killed) != 1 || fake.killed[0] != "drone-service" {
+		t.Errorf("Expect container killed, got %v", fake.killed)
+	}
+}
+
+// This test verifies that the containers of a cancelled
+// pipeline are stopped gracefully.
+func TestDestroy_Cancelled(t *testing.T) {
+	fake := new(fakeClient)
+	engine := New(fake, Opts{})
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{{ID: "drone-service", Name: "redis", Detach: true}},
+	}
+	spec.interrupt()
+	engine.Destroy(context.Background(), spec)
+	if len(fake.stopped) != 1 || fake.stopped[0] != "drone-service" {
+		t.Errorf("Expect container stopped, got %v", fake.stopped)
+	}
+}
+
+// This test verifies that the images built through the docker
+// socket proxy are removed.
+func TestDestroy_ProxyImages(t *testing.T) {
+	fake := &fakeClient{images: []string{"sha256:3b4d5e"}}
+	engine := New(fake, Opts{})
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Internal: []*Step{
+			{ID: "drone-proxy", Labels: map[string]string{LabelProxy: "stage"}},
+		},
+	}
+	engine.Destroy(context.Background(), spec)
+	if len(fake.images) != 0 {
+		t.Errorf("Expect proxy images removed, got %v", fake.images)
+	}
+}
+
+// This test verifies that the retry is written to the step
+// logs, and that cancelling the pipeline during the retry
+// delay fails the step.
+func TestRun_NoUsage(t *testing.T) {
+	fake := &fakeClient{}
+	engine := New(fake, Opts{})
+	step := &Step{
+		ID:    "drone-step",
+		Name:  "test",
+		Image: "golang:1.14",
+		Pull:  PullIfNotExists,
+	}
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{step},
+	}
+
+	output := new(bytes.Buffer)
+	if _, err := engine.Run(context.Background(), spec, step, output); err != nil {
+		t.Error(err)
+	}
+	// the fake client does not stream container stats, so the
+	// resource usage is neither reported nor recorded.
+	if strings.Contains(output.String(), "resource usage") {
+		t.Errorf("Expect resource usage not reported, got %q", output.String())
+	}
+	if usage := spec.Results()[0].Usage; usage != nil {
+		t.Errorf("Expect nil resource usage, got %v", usage)
+	}
+}
+
+func TestRun_RetryCancelled(t *testing.T) {
+	fake := &fakeClient{exitCode: 1}
+	engine := New(fake, Opts{})
+	step := &Step{
+		ID:    "drone-step",
+		Name:  "test",
+		Image: "golang:1.14",
+		Pull:  PullIfNotExists,
+		Retry: &Retry{Attempts: 2, Delay: time.Hour},
+	}
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{step},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	output := new(bytes.Buffer)
+	_, err := engine.Run(ctx, spec, step, output)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Want deadline exceeded error, got %v", err)
+	}
+	if !strings.Contains(output.String(), "retrying (attempt 2/2)") {
+		t.Errorf("Expect retry reported, got %q", output.String())
+	}
+	if got, want := spec.Results()[0].Status, statusFailure; got != want {
+		t.Errorf("Want status %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/joho/godotenv"
+)
+
+// RestrictedVars provides the list of environment variables
+// that are restricted for internal use only.
+var RestrictedVars = []string{
+	"XDG_RUNTIME_DIR",
+	"DOCKER_OPTS",
+	"DOCKER_HOST",
+	"PATH",
+	"HOME",
+}
+
+// helper function returns true if the environment variable
+// is restricted for internal use only.
+func isRestrictedVar(name string) bool {
+	for _, restricted := range RestrictedVars {
+		if name == restricted {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function merges the environment variables written to
+// the environment file by previous steps into the step
+// environment. Variables defined by the step take precedence.
+func (s *Spec) mergeEnvFile(step *Step) {
+	if step.EnvFile == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range s.envs {
+		if _, ok := step.Envs[k]; ok {
+			continue
+		}
+		step.Envs[k] = v
+	}
+}
+
+// helper function reads the environment variables the step
+// appended to the environment file, which are merged into the
+// environment of later steps. Reserved variables cannot be
+// set and are ignored.
+func (e *Docker) collectEnvFile(ctx context.Context, spec *Spec, step *Step, w io.Writer) {
+	if step.EnvFile == "" {
+		return
+	}
+	raw, err := e.readFile(ctx, step.ID, step.EnvFile)
+	if err != nil {
+		fmt.Fprintf(w, "cannot read environment file: %s\n", err)
+		return
+	}
+	if len(raw) == 0 {
+		return
+	}
+	envs, err := godotenv.Parse(bytes.NewReader(raw))
+	if err != nil {
+		fmt.Fprintf(w, "cannot read environment file: %s\n", err)
+		return
+	}
+
+	spec.mu.Lock()
+	defer spec.mu.Unlock()
+	if spec.envs == nil {
+		spec.envs = map[string]string{}
+	}
+	for k, v := range envs {
+		if isReservedVar(k) || !outputNameRE.MatchString(k) {
+			fmt.Fprintf(w, "cannot set environment variable %s\n", k)
+			continue
+		}
+		spec.envs[k] = v
+	}
+}
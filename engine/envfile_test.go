@@ -0,0 +1,61 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEnvFile(t *testing.T) {
+	fake := &fakeClient{
+		files: map[string]string{
+			"/drone/src/.drone_env_build": "VERSION=1.2.3\nPATH=/tmp/bin\nDRONE_NETRC_PASSWORD=hunter2\nexport GOFLAGS=-mod=vendor\nGOOS=linux\n",
+		},
+	}
+	engine := New(fake, Opts{})
+	spec := new(Spec)
+
+	build := &Step{ID: "build", EnvFile: "/drone/src/.drone_env_build"}
+	output := new(bytes.Buffer)
+	engine.collectEnvFile(context.Background(), spec, build, output)
+	for _, name := range []string{"PATH", "DRONE_NETRC_PASSWORD"} {
+		if !strings.Contains(output.String(), "cannot set environment variable "+name+"\n") {
+			t.Errorf("Want reserved variable %s reported, got %q", name, output.String())
+		}
+	}
+
+	test := &Step{
+		ID:      "test",
+		EnvFile: "/drone/src/.drone_env_test",
+		Envs:    map[string]string{"PATH": "/usr/bin", "GOOS": "windows"},
+	}
+	spec.mergeEnvFile(test)
+	if got, want := test.Envs["VERSION"], "1.2.3"; got != want {
+		t.Errorf("Want VERSION %q, got %q", want, got)
+	}
+	if got, want := test.Envs["GOFLAGS"], "-mod=vendor"; got != want {
+		t.Errorf("Want GOFLAGS %q, got %q", want, got)
+	}
+	if got, want := test.Envs["PATH"], "/usr/bin"; got != want {
+		t.Errorf("Want restricted PATH %q, got %q", want, got)
+	}
+	if _, ok := test.Envs["DRONE_NETRC_PASSWORD"]; ok {
+		t.Errorf("Expect reserved DRONE_NETRC_PASSWORD not merged")
+	}
+	if got, want := test.Envs["GOOS"], "windows"; got != want {
+		t.Errorf("Want step defined GOOS %q, got %q", want, got)
+	}
+
+	// the environment file is optional.
+	missing := &Step{ID: "missing", EnvFile: "/drone/src/.drone_env_missing"}
+	output.Reset()
+	engine.collectEnvFile(context.Background(), spec, missing, output)
+	if output.Len() != 0 {
+		t.Errorf("Expect missing environment file ignored, got %q", output.String())
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// exitWatch receives the lifecycle events of a single
+// container, and is closed when the container exits.
+type exitWatch struct {
+	done chan struct{}
+
+	mu     sync.Mutex
+	oom    bool
+	signal string
+	once   sync.Once
+}
+
+// helper function closes the watch once the container exits.
+func (w *exitWatch) exit() {
+	w.once.Do(func() { close(w.done) })
+}
+
+// helper function returns true if the container ran out of
+// memory, and the signal the container was killed with.
+func (w *exitWatch) status() (oom bool, signal string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.oom, w.signal
+}
+
+// exitMonitor subscribes to the Docker events for pipeline
+// containers, and notifies the steps waiting for a container
+// to exit. A single subscription is shared by all pipelines
+// executed by the engine.
+type exitMonitor struct {
+	client client.APIClient
+	once   sync.Once
+
+	mu      sync.Mutex
+	watches map[string]*exitWatch
+}
+
+// helper function returns a new exit monitor.
+func newExitMonitor(client client.APIClient) *exitMonitor {
+	return &exitMonitor{
+		client:  client,
+		watches: map[string]*exitWatch{},
+	}
+}
+
+// helper function starts the events subscription, if not
+// already started.
+func (m *exitMonitor) start() {
+	m.once.Do(func() {
+		go m.run(context.Background(), time.Now())
+	})
+}
+
+// helper function watches the named container. The watch must
+// be registered before the container is started, otherwise the
+// exit may not be observed.
+func (m *exitMonitor) watch(name string) *exitWatch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := &exitWatch{done: make(chan struct{})}
+	m.watches[name] = w
+	return w
+}
+
+// helper function stops watching the named container.
+func (m *exitMonitor) unwatch(name string, w *exitWatch) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watches[name] == w {
+		delete(m.watches, name)
+	}
+}
+
+// helper function returns the watch for the named container.
+func (m *exitMonitor) lookup(name string) (*exitWatch, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.watches[name]
+	return w, ok
+}
+
+// helper function streams the container events, resuming the
+// stream from the last received event if the stream fails.
+func (m *exitMonitor) run(ctx context.Context, since time.Time) {
+	args := filters.NewArgs(
+		filters.Arg("type", events.ContainerEventType),
+		filters.Arg("event", "die"),
+		filters.Arg("event", "oom"),
+		filters.Arg("event", "kill"),
+		filters.Arg("label", "io.drone.stage.number"),
+	)
+	for {
+		msgs, errs := m.client.Events(ctx, types.EventsOptions{
+			Since:   fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()),
+			Filters: args,
+		})
+	stream:
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg := <-msgs:
+				since = time.Unix(0, msg.TimeNano)
+				m.handle(msg)
+			case err := <-errs:
+				logger.FromContext(ctx).
+					WithError(err).
+					Debugln("docker events stream interrupted")
+				break stream
+			}
+		}
+		// exits may be missed while the stream reconnects, so
+		// the stream is resumed from the last received event.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// helper function updates the watch for the container that
+// generated the event.
+func (m *exitMonitor) handle(msg events.Message) {
+	w, ok := m.lookup(msg.Actor.Attributes["name"])
+	if !ok {
+		return
+	}
+	switch msg.Action {
+	case "oom":
+		w.mu.Lock()
+		w.oom = true
+		w.mu.Unlock()
+	case "kill":
+		w.mu.Lock()
+		w.signal = msg.Actor.Attributes["signal"]
+		w.mu.Unlock()
+	case "die":
+		w.exit()
+	}
+}
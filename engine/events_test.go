@@ -0,0 +1,72 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types/events"
+)
+
+func TestExitMonitor(t *testing.T) {
+	m := newExitMonitor(nil)
+	w := m.watch("drone-step")
+
+	message := func(action string, attrs map[string]string) events.Message {
+		attrs["name"] = "drone-step"
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor:  events.Actor{Attributes: attrs},
+		}
+	}
+
+	m.handle(message("oom", map[string]string{}))
+	m.handle(message("kill", map[string]string{"signal": "9"}))
+	select {
+	case <-w.done:
+		t.Fatalf("Expect watch is open until the container dies")
+	default:
+	}
+
+	m.handle(message("die", map[string]string{"exitCode": "137"}))
+	select {
+	case <-w.done:
+	default:
+		t.Fatalf("Expect watch is closed when the container dies")
+	}
+
+	oom, signal := w.status()
+	if !oom {
+		t.Errorf("Expect container is oom killed")
+	}
+	if signal != "9" {
+		t.Errorf("Want signal 9, got %q", signal)
+	}
+
+	// events for containers that are not watched, or that
+	// are received after the watch is removed, are ignored.
+	m.unwatch("drone-step", w)
+	m.handle(message("die", map[string]string{}))
+}
+
+// This test verifies that the container exit is detected by
+// the docker wait command if the exit event is missed.
+func TestWaitExit_MissedEvent(t *testing.T) {
+	fake := &fakeClient{exitCode: 2}
+	engine := New(fake, Opts{})
+	exit := engine.monitor.watch("drone-step")
+	defer engine.monitor.unwatch("drone-step", exit)
+
+	state, err := engine.waitExit(context.Background(), "drone-step", exit)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got, want := state.ExitCode, 2; got != want {
+		t.Errorf("Want exit code %d, got %d", want, got)
+	}
+}
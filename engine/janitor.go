@@ -0,0 +1,190 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/drone/runner-go/logger"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+// orphanLabels are the labels added to each stage resource by
+// the compiler, which identify resources created by a runner.
+var orphanLabels = []string{
+	"io.drone.build.number",
+	"io.drone.stage.number",
+}
+
+// Reclaimed reports the orphaned resources that were removed
+// by the engine.
+type Reclaimed struct {
+	Containers []string
+	Volumes    []string
+	Networks   []string
+}
+
+// Len returns the number of reclaimed resources.
+func (r *Reclaimed) Len() int {
+	return len(r.Containers) + len(r.Volumes) + len(r.Networks)
+}
+
+// helper function tracks the pipeline resources, which prevents
+// the resources from being reclaimed while the pipeline runs.
+func (e *Docker) track(spec *Spec) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.tracked == nil {
+		e.tracked = map[*Spec]struct{}{}
+	}
+	e.tracked[spec] = struct{}{}
+}
+
+// helper function stops tracking the pipeline resources.
+func (e *Docker) untrack(spec *Spec) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.tracked, spec)
+}
+
+// helper function returns the set of resource identifiers
+// that belong to pipelines tracked by the engine.
+func (e *Docker) trackedIDs() map[string]struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ids := map[string]struct{}{}
+	for spec := range e.tracked {
+		ids[spec.Network.ID] = struct{}{}
+		for _, step := range append(spec.Steps, spec.Internal...) {
+			ids[step.ID] = struct{}{}
+		}
+		if spec.Diff != nil {
+			ids[spec.Diff.ID] = struct{}{}
+		}
+		for _, vol := range spec.Volumes {
+			if vol.EmptyDir != nil {
+				ids[vol.EmptyDir.ID] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
+
+// Reclaim removes the containers, volumes and networks created
+// for a pipeline stage that are no longer tracked by the engine,
+// such as resources leaked when the runner process exits during
+// a build. Resources are only removed once they are older than
+// the maximum age, since resources may belong to another runner
+// on the same host, and containers are only removed once they
+// are no longer running.
+func (e *Docker) Reclaim(ctx context.Context, maxAge time.Duration) (*Reclaimed, error) {
+	args := filters.NewArgs()
+	for _, label := range orphanLabels {
+		args.Add("label", label)
+	}
+	tracked := e.trackedIDs()
+	reclaimed := new(Reclaimed)
+	expired := func(created time.Time) bool {
+		return !created.IsZero() && time.Since(created) > maxAge
+	}
+
+	containers, err := e.client.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: args,
+	})
+	if err != nil {
+		return reclaimed, err
+	}
+	for _, c := range containers {
+		if isTracked(tracked, append(c.Names, c.ID)...) || !expired(time.Unix(c.Created, 0)) || !isStopped(c) {
+			continue
+		}
+		if err := e.remove(ctx, c.ID); err != nil {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("container", c.ID).
+				Debugln("cannot remove orphaned container")
+			continue
+		}
+		reclaimed.Containers = append(reclaimed.Containers, containerName(c))
+	}
+
+	volumes, err := e.client.VolumeList(ctx, args)
+	if err != nil {
+		return reclaimed, err
+	}
+	for _, v := range volumes.Volumes {
+		created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+		if isTracked(tracked, v.Name) || !expired(created) {
+			continue
+		}
+		if err := e.client.VolumeRemove(ctx, v.Name, false); err != nil && !client.IsErrNotFound(err) {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("volume", v.Name).
+				Debugln("cannot remove orphaned volume")
+			continue
+		}
+		reclaimed.Volumes = append(reclaimed.Volumes, v.Name)
+	}
+
+	networks, err := e.client.NetworkList(ctx, types.NetworkListOptions{
+		Filters: args,
+	})
+	if err != nil {
+		return reclaimed, err
+	}
+	for _, n := range networks {
+		if isTracked(tracked, n.ID, n.Name) || !expired(n.Created) {
+			continue
+		}
+		if err := e.client.NetworkRemove(ctx, n.ID); err != nil && !client.IsErrNotFound(err) {
+			logger.FromContext(ctx).
+				WithError(err).
+				WithField("network", n.Name).
+				Debugln("cannot remove orphaned network")
+			continue
+		}
+		reclaimed.Networks = append(reclaimed.Networks, n.Name)
+	}
+	return reclaimed, nil
+}
+
+// helper function returns true if any of the resource names
+// are tracked. Container names are prefixed with a slash.
+func isTracked(tracked map[string]struct{}, names ...string) bool {
+	for _, name := range names {
+		if _, ok := tracked[strings.TrimPrefix(name, "/")]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the container is not
+// running. A running container may belong to a build that is
+// still in progress on another runner.
+func isStopped(c types.Container) bool {
+	switch c.State {
+	case "created", "exited", "dead":
+		return true
+	default:
+		return false
+	}
+}
+
+// helper function returns the container name, or the
+// container identifier if the container is unnamed.
+func containerName(c types.Container) string {
+	if len(c.Names) != 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return c.ID
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeJanitorClient is a Docker client that lists the stage
+// resources, and records the resources that are removed.
+type fakeJanitorClient struct {
+	client.APIClient
+
+	containers []types.Container
+	volumes    []*types.Volume
+	networks   []types.NetworkResource
+	removed    []string
+}
+
+func (c *fakeJanitorClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	return c.containers, nil
+}
+
+func (c *fakeJanitorClient) ContainerRemove(ctx context.Context, id string, options types.ContainerRemoveOptions) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func (c *fakeJanitorClient) VolumeList(ctx context.Context, args filters.Args) (volumetypes.VolumeListOKBody, error) {
+	return volumetypes.VolumeListOKBody{Volumes: c.volumes}, nil
+}
+
+func (c *fakeJanitorClient) VolumeRemove(ctx context.Context, id string, force bool) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func (c *fakeJanitorClient) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	return c.networks, nil
+}
+
+func (c *fakeJanitorClient) NetworkRemove(ctx context.Context, id string) error {
+	c.removed = append(c.removed, id)
+	return nil
+}
+
+func TestTracked(t *testing.T) {
+	spec := &Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{{ID: "drone-step"}},
+		Volumes: []*Volume{
+			{EmptyDir: &VolumeEmptyDir{ID: "drone-volume"}},
+			{HostPath: &VolumeHostPath{ID: "drone-host", Path: "/tmp"}},
+		},
+	}
+
+	e := new(Docker)
+	e.track(spec)
+	tracked := e.trackedIDs()
+	for _, name := range []string{"drone-network", "/drone-step", "drone-volume"} {
+		if !isTracked(tracked, name) {
+			t.Errorf("Expect %s is tracked", name)
+		}
+	}
+	if isTracked(tracked, "drone-orphan") {
+		t.Errorf("Expect orphaned resource is not tracked")
+	}
+
+	e.untrack(spec)
+	if isTracked(e.trackedIDs(), "drone-step") {
+		t.Errorf("Expect resources are not tracked once destroyed")
+	}
+}
+
+// This test verifies that Reclaim only removes the resources
+// that are older than the maximum age and not tracked by the
+// engine, and does not remove running containers.
+func TestReclaim(t *testing.T) {
+	old := time.Now().Add(-2 * time.Hour)
+	recent := time.Now().Add(-time.Minute)
+	fake := &fakeJanitorClient{
+		containers: []types.Container{
+			{ID: "c1", Names: []string{"/drone-orphan"}, Created: old.Unix(), State: "exited"},
+			{ID: "c2", Names: []string{"/drone-step"}, Created: old.Unix(), State: "exited"},
+			{ID: "c3", Names: []string{"/drone-recent"}, Created: recent.Unix(), State: "exited"},
+			{ID: "c4", Names: []string{"/drone-running"}, Created: old.Unix(), State: "running"},
+		},
+		volumes: []*types.Volume{
+			{Name: "drone-orphan-volume", CreatedAt: old.Format(time.RFC3339)},
+			{Name: "drone-volume", CreatedAt: old.Format(time.RFC3339)},
+			{Name: "drone-recent-volume", CreatedAt: recent.Format(time.RFC3339)},
+		},
+		networks: []types.NetworkResource{
+			{ID: "n1", Name: "drone-orphan-network", Created: old},
+			{ID: "drone-network", Name: "drone-network", Created: old},
+			{ID: "n3", Name: "drone-recent-network", Created: recent},
+		},
+	}
+
+	e := &Docker{client: fake}
+	e.track(&Spec{
+		Network: Network{ID: "drone-network"},
+		Steps:   []*Step{{ID: "drone-step"}},
+		Volumes: []*Volume{
+			{EmptyDir: &VolumeEmptyDir{ID: "drone-volume"}},
+		},
+	})
+
+	reclaimed, err := e.Reclaim(context.Background(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Reclaimed{
+		Containers: []string{"drone-orphan"},
+		Volumes:    []string{"drone-orphan-volume"},
+		Networks:   []string{"drone-orphan-network"},
+	}
+	if diff := cmp.Diff(want, reclaimed); diff != "" {
+		t.Errorf(diff)
+	}
+	if diff := cmp.Diff([]string{"c1", "drone-orphan-volume", "n1"}, fake.removed); diff != "" {
+		t.Errorf(diff)
+	}
+}
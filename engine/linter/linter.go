@@ -10,7 +10,9 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/drone-runners/drone-runner-docker/engine"
 	"github.com/drone-runners/drone-runner-docker/engine/resource"
+	"github.com/drone-runners/drone-runner-docker/internal/expr"
 	"github.com/drone/drone-go/drone"
 	"github.com/drone/runner-go/manifest"
 )
@@ -50,6 +52,18 @@ func checkPipeline(pipeline *resource.Pipeline, trusted bool) error {
 	if err := checkVolumes(pipeline, trusted); err != nil {
 		return err
 	}
+	if err := checkReady(pipeline); err != nil {
+		return err
+	}
+	if err := checkCaches(pipeline); err != nil {
+		return err
+	}
+	if err := checkMatrix(pipeline); err != nil {
+		return err
+	}
+	if err := checkExprs(pipeline); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -101,6 +115,19 @@ func checkStep(step *resource.Step, trusted bool) error {
 	if step.Image == "" {
 		return errors.New("linter: invalid or missing image")
 	}
+	switch step.Shell {
+	case "", "sh", "bash", "pwsh", "powershell", "python":
+	default:
+		return fmt.Errorf("linter: unsupported shell %s", step.Shell)
+	}
+	if _, _, err := engine.ParsePullPolicy(step.Pull); err != nil {
+		return fmt.Errorf("linter: %s", err)
+	}
+	if step.When.Expr != "" {
+		if _, err := expr.Parse(step.When.Expr); err != nil {
+			return fmt.Errorf("linter: invalid expression: %s", err)
+		}
+	}
 	// if step.Name == "" {
 	// 	return errors.New("linter: invalid or missing name")
 	// }
@@ -128,9 +155,25 @@ func checkStep(step *resource.Step, trusted bool) error {
 	if trusted == false && int(step.ShmSize) > 0 {
 		return errors.New("linter: untrusted repositories cannot configure shm_size")
 	}
+	for _, capability := range step.CapAdd {
+		if trusted == false && !isDefaultCapability(capability) {
+			return fmt.Errorf("linter: untrusted repositories cannot add capability %s", capability)
+		}
+	}
+	for _, opt := range step.SecurityOpt {
+		if trusted == false && !strings.HasPrefix(opt, "no-new-privileges") {
+			return errors.New("linter: untrusted repositories cannot configure security_opt")
+		}
+	}
+	if trusted == false && len(step.Runtime) > 0 {
+		return errors.New("linter: untrusted repositories cannot configure runtime")
+	}
+	if trusted == false && len(step.Sysctls) > 0 {
+		return errors.New("linter: untrusted repositories cannot configure sysctls")
+	}
 	for _, mount := range step.Volumes {
 		switch mount.Name {
-		case "workspace", "_workspace", "_docker_socket":
+		case "workspace", "_workspace", "_docker_socket", "_docker_proxy":
 			return fmt.Errorf("linter: invalid volume name: %s", mount.Name)
 		}
 		if strings.HasPrefix(filepath.Clean(mount.MountPath), "/run/drone") {
@@ -157,7 +200,7 @@ func checkVolumes(pipeline *resource.Pipeline, trusted bool) error {
 		switch volume.Name {
 		case "":
 			return fmt.Errorf("linter: missing volume name")
-		case "workspace", "_workspace", "_docker_socket":
+		case "workspace", "_workspace", "_docker_socket", "_docker_proxy":
 			return fmt.Errorf("linter: invalid volume name: %s", volume.Name)
 		}
 	}
@@ -178,6 +221,143 @@ func checkEmptyDirVolume(volume *resource.VolumeEmptyDir, trusted bool) error {
 	return nil
 }
 
+func checkReady(pipeline *resource.Pipeline) error {
+	for _, step := range pipeline.Steps {
+		if step.Ready != nil && step.Detach == false {
+			return fmt.Errorf("linter: readiness probes are only supported for services: %s", step.Name)
+		}
+	}
+	for _, step := range append(pipeline.Services, pipeline.Steps...) {
+		if step.Ready == nil {
+			continue
+		}
+		if step.Ready.Healthcheck == false && step.Ready.Port == 0 && len(step.Ready.Command) == 0 {
+			return fmt.Errorf("linter: readiness probe must define a healthcheck, port or command: %s", step.Name)
+		}
+	}
+	return nil
+}
+
+func checkMatrix(pipeline *resource.Pipeline) error {
+	for _, step := range pipeline.Services {
+		if len(step.Matrix) != 0 {
+			return fmt.Errorf("linter: matrix is only supported for steps: %s", step.Name)
+		}
+	}
+	for _, step := range pipeline.Steps {
+		for key, values := range step.Matrix {
+			if len(values) == 0 {
+				return fmt.Errorf("linter: matrix %s must define at least one value: %s", key, step.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// helper function returns an error if a step expression
+// references a step that is not an upstream dependency, since
+// the step may not have completed when the expression is
+// evaluated, or references a matrix step, since the expanded
+// step names cannot be referenced.
+func checkExprs(pipeline *resource.Pipeline) error {
+	steps := append(pipeline.Services, pipeline.Steps...)
+	upstream := upstreamSteps(pipeline)
+	for _, step := range steps {
+		if step.When.Expr == "" {
+			continue
+		}
+		x, err := expr.Parse(step.When.Expr)
+		if err != nil {
+			return fmt.Errorf("linter: invalid expression: %s", err)
+		}
+		for _, name := range x.Vars() {
+			parts := strings.Split(name, ".")
+			if parts[0] != "steps" {
+				continue
+			}
+			ref := parts[1]
+			for _, other := range steps {
+				if other.Name == ref && len(other.Matrix) != 0 {
+					return fmt.Errorf("linter: expression cannot reference matrix step: %s references %s", step.Name, ref)
+				}
+			}
+			if _, ok := upstream[step.Name][ref]; !ok {
+				return fmt.Errorf("linter: expression references step that is not a dependency: %s references %s", step.Name, ref)
+			}
+		}
+	}
+	return nil
+}
+
+// helper function returns the upstream steps of each step,
+// which are the steps that complete before the step runs. If
+// no step defines dependencies the steps run serially.
+func upstreamSteps(pipeline *resource.Pipeline) map[string]map[string]struct{} {
+	steps := append(pipeline.Services, pipeline.Steps...)
+	upstream := map[string]map[string]struct{}{}
+	var graph bool
+	for _, step := range steps {
+		upstream[step.Name] = map[string]struct{}{}
+		if !pipeline.Clone.Disable {
+			upstream[step.Name]["clone"] = struct{}{}
+		}
+		if len(step.DependsOn) != 0 {
+			graph = true
+		}
+	}
+	if !graph {
+		for i, step := range steps {
+			for _, prev := range steps[:i] {
+				upstream[step.Name][prev.Name] = struct{}{}
+			}
+		}
+		return upstream
+	}
+
+	// the dependencies are resolved transitively. the linter
+	// does not reject cycles, so visited steps are tracked.
+	deps := map[string][]string{}
+	for _, step := range steps {
+		deps[step.Name] = step.DependsOn
+	}
+	for _, step := range steps {
+		pending := append([]string(nil), step.DependsOn...)
+		for len(pending) != 0 {
+			name := pending[0]
+			pending = pending[1:]
+			if _, ok := upstream[step.Name][name]; ok {
+				continue
+			}
+			upstream[step.Name][name] = struct{}{}
+			pending = append(pending, deps[name]...)
+		}
+	}
+	return upstream
+}
+
+func checkCaches(pipeline *resource.Pipeline) error {
+	names := map[string]struct{}{}
+	for _, cache := range pipeline.Cache {
+		if cache.Name == "" {
+			return errors.New("linter: missing cache name")
+		}
+		if _, ok := names[cache.Name]; ok {
+			return fmt.Errorf("linter: duplicate cache name: %s", cache.Name)
+		}
+		names[cache.Name] = struct{}{}
+		if cache.Key == "" {
+			return fmt.Errorf("linter: missing cache key: %s", cache.Name)
+		}
+		if !strings.HasPrefix(cache.Path, "/") {
+			return fmt.Errorf("linter: cache path must be absolute: %s", cache.Name)
+		}
+		if strings.HasPrefix(filepath.Clean(cache.Path), "/run/drone") {
+			return fmt.Errorf("linter: cannot mount cache at /run/drone")
+		}
+	}
+	return nil
+}
+
 func checkDeps(step *resource.Step, deps map[string]struct{}) error {
 	for _, dep := range step.DependsOn {
 		_, ok := deps[dep]
@@ -190,3 +370,31 @@ func checkDeps(step *resource.Step, deps map[string]struct{}) error {
 	}
 	return nil
 }
+
+// defaultCapabilities provides the capabilities granted to
+// containers by default. Adding these capabilities does not
+// escalate the privileges of the container.
+var defaultCapabilities = map[string]struct{}{
+	"AUDIT_WRITE":      {},
+	"CHOWN":            {},
+	"DAC_OVERRIDE":     {},
+	"FOWNER":           {},
+	"FSETID":           {},
+	"KILL":             {},
+	"MKNOD":            {},
+	"NET_BIND_SERVICE": {},
+	"NET_RAW":          {},
+	"SETFCAP":          {},
+	"SETGID":           {},
+	"SETPCAP":          {},
+	"SETUID":           {},
+	"SYS_CHROOT":       {},
+}
+
+// helper function returns true if the capability is granted
+// to containers by default.
+func isDefaultCapability(capability string) bool {
+	capability = strings.TrimPrefix(strings.ToUpper(capability), "CAP_")
+	_, ok := defaultCapabilities[capability]
+	return ok
+}
@@ -128,6 +128,131 @@ func TestLint(t *testing.T) {
 			trusted: true,
 			invalid: false,
 		},
+		// user should not be able to add capabilities or
+		// configure security options unless the repository
+		// is trusted.
+		{
+			path:    "testdata/pipeline_cap_add.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: untrusted repositories cannot add capability SYS_ADMIN",
+		},
+		{
+			path:    "testdata/pipeline_cap_add.yml",
+			trusted: true,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_cap_add_default.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_security_opt.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: untrusted repositories cannot configure security_opt",
+		},
+		{
+			path:    "testdata/pipeline_security_opt.yml",
+			trusted: true,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_sysctls.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: untrusted repositories cannot configure sysctls",
+		},
+		{
+			path:    "testdata/pipeline_sysctls.yml",
+			trusted: true,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_shell.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: unsupported shell fish",
+		},
+		{
+			path:    "testdata/pipeline_pull.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_pull_invalid.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: invalid pull policy: sometimes",
+		},
+		{
+			path:    "testdata/pipeline_pull_invalid_age.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: invalid pull policy: if-older-than 1day",
+		},
+		{
+			path:    "testdata/pipeline_expr.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_expr_invalid.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: invalid expression: unknown variable DRONE_BRANCH",
+		},
+		{
+			path:    "testdata/pipeline_expr_upstream.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_expr_serial.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_expr_not_upstream.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: expression references step that is not a dependency: notify references test",
+		},
+		{
+			path:    "testdata/pipeline_expr_matrix.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: expression cannot reference matrix step: notify references test",
+		},
+		{
+			path:    "testdata/pipeline_matrix.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_matrix_empty.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: matrix db must define at least one value: test",
+		},
+		{
+			path:    "testdata/pipeline_matrix_service.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: matrix is only supported for steps: redis",
+		},
+		{
+			path:    "testdata/pipeline_runtime.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: untrusted repositories cannot configure runtime",
+		},
+		{
+			path:    "testdata/pipeline_runtime.yml",
+			trusted: true,
+			invalid: false,
+		},
 		// user should not be able to set dns, dns_search or
 		// extra_hosts unless the repository is trusted.
 		{
@@ -174,6 +299,44 @@ func TestLint(t *testing.T) {
 			trusted: true,
 			invalid: false,
 		},
+		// user should only be able to define readiness
+		// probes for services.
+		{
+			path:    "testdata/service_ready.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/pipeline_ready.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: readiness probes are only supported for services: test",
+		},
+		{
+			path:    "testdata/service_ready_empty.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: readiness probe must define a healthcheck, port or command: database",
+		},
+		// user should be able to define build caches with
+		// unique names and absolute mount paths.
+		{
+			path:    "testdata/cache.yml",
+			trusted: false,
+			invalid: false,
+		},
+		{
+			path:    "testdata/cache_relative_path.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: cache path must be absolute: go",
+		},
+		{
+			path:    "testdata/cache_duplicate_name.yml",
+			trusted: false,
+			invalid: true,
+			message: "linter: duplicate cache name: go",
+		},
 
 		//
 		// The below checks were moved to the parser, however, we
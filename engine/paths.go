@@ -0,0 +1,108 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// changes lists the files changed by the build, which are
+// computed once by the internal diff step.
+type changes struct {
+	once  sync.Once
+	files []string
+	err   error
+}
+
+// helper function returns true if the step should run, which
+// is the case if any changed file matches the step path
+// conditions. The files changed by the build are computed by
+// the internal diff step the first time a step with path
+// conditions runs, after the clone step. If the changed files
+// cannot be computed, the path conditions are ignored.
+func (e *Docker) matchPaths(ctx context.Context, spec *Spec, step *Step) (bool, error) {
+	if step.Paths == nil {
+		return true, nil
+	}
+	spec.changes.once.Do(func() {
+		spec.changes.files, spec.changes.err = e.diff(ctx, spec)
+	})
+	if err := spec.changes.err; err != nil {
+		return true, err
+	}
+	return step.Paths.match(spec.changes.files), nil
+}
+
+// helper function runs the internal diff step and returns the
+// list of files changed by the build.
+func (e *Docker) diff(ctx context.Context, spec *Spec) ([]string, error) {
+	step := spec.Diff
+	if step == nil {
+		return nil, fmt.Errorf("changed files are not available")
+	}
+	if err := e.create(ctx, spec, step, ioutil.Discard); err != nil {
+		return nil, err
+	}
+	if err := e.start(ctx, step.ID); err != nil {
+		return nil, err
+	}
+
+	// the internal containers perform short-lived tasks and
+	// should not require > 1 minute to execute.
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	state, err := e.wait(ctx, step.ID)
+	if err != nil {
+		return nil, err
+	}
+	if state.ExitCode != 0 {
+		return nil, fmt.Errorf("cannot list changed files: exit code %d", state.ExitCode)
+	}
+
+	raw, err := e.readFile(ctx, step.ID, step.Output)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(string(raw), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, nil
+}
+
+// helper function returns true if any of the files matches the
+// include patterns and does not match the exclude patterns.
+func (p *Paths) match(files []string) bool {
+	for _, file := range files {
+		if matchGlob(p.Exclude, file) {
+			continue
+		}
+		if len(p.Include) == 0 || matchGlob(p.Include, file) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the file matches any of the
+// glob patterns. The ** pattern matches any number of nested
+// directories.
+func matchGlob(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := doublestar.Match(pattern, file); ok {
+			return true
+		}
+	}
+	return false
+}
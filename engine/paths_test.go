@@ -0,0 +1,97 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPaths_Match(t *testing.T) {
+	tests := []struct {
+		paths Paths
+		files []string
+		match bool
+	}{
+		{Paths{Include: []string{"api/**"}}, []string{"api/main.go"}, true},
+		{Paths{Include: []string{"api/**"}}, []string{"web/index.html"}, false},
+		{Paths{Exclude: []string{"**/*.md"}}, []string{"docs/README.md"}, false},
+		{Paths{Exclude: []string{"**/*.md"}}, []string{"docs/README.md", "main.go"}, true},
+		{Paths{Include: []string{"api/**"}, Exclude: []string{"**/*.md"}}, []string{"api/README.md"}, false},
+		{Paths{Include: []string{"api/**"}}, nil, false},
+		// the ** pattern matches nested directories.
+		{Paths{Include: []string{"api/**"}}, []string{"api/v1/users/main.go"}, true},
+		{Paths{Include: []string{"api/**/*.go"}}, []string{"api/v1/users/main.go"}, true},
+		{Paths{Include: []string{"api/**/*.go"}}, []string{"api/v1/users/README.md"}, false},
+		{Paths{Include: []string{"api/*"}}, []string{"api/v1/main.go"}, false},
+		{Paths{Exclude: []string{"**/*.md"}}, []string{"docs/api/v1/README.md"}, false},
+		{Paths{Exclude: []string{"docs/**"}}, []string{"docs/api/v1/index.html"}, false},
+		{Paths{Exclude: []string{"docs/**"}}, []string{"docs/api/v1/index.html", "api/v1/main.go"}, true},
+		{Paths{Include: []string{"api/**"}, Exclude: []string{"api/**/testdata/**"}}, []string{"api/v1/testdata/users.json"}, false},
+		{Paths{Include: []string{"api/**"}, Exclude: []string{"api/**/testdata/**"}}, []string{"api/v1/testdata/users.json", "api/v1/users.go"}, true},
+	}
+	for i, test := range tests {
+		if got, want := test.paths.match(test.files), test.match; got != want {
+			t.Errorf("Want match %v at index %d, got %v", want, i, got)
+		}
+	}
+}
+
+func TestMatchPaths(t *testing.T) {
+	fake := &fakeClient{
+		files: map[string]string{
+			"/tmp/drone_changes": "api/main.go\napi/README.md\n",
+		},
+	}
+	engine := New(fake, Opts{})
+	spec := &Spec{
+		Diff: &Step{ID: "diff", Image: "drone/git", Pull: PullIfNotExists, Output: "/tmp/drone_changes"},
+	}
+
+	api := &Step{Name: "api", Paths: &Paths{Include: []string{"api/**"}}}
+	web := &Step{Name: "web", Paths: &Paths{Include: []string{"web/**"}}}
+	all := &Step{Name: "all"}
+	for _, test := range []struct {
+		step  *Step
+		match bool
+	}{
+		{api, true},
+		{web, false},
+		{all, true},
+	} {
+		match, err := engine.matchPaths(context.Background(), spec, test.step)
+		if err != nil {
+			t.Error(err)
+		}
+		if got, want := match, test.match; got != want {
+			t.Errorf("Want step %s match %v, got %v", test.step.Name, want, got)
+		}
+	}
+
+	// the diff step runs once, the first time a step with
+	// path conditions runs.
+	if got, want := len(fake.started), 1; got != want {
+		t.Errorf("Want diff step started %d times, got %d", want, got)
+	}
+}
+
+func TestMatchPaths_Error(t *testing.T) {
+	fake := &fakeClient{exitCode: 128}
+	engine := New(fake, Opts{})
+	spec := &Spec{
+		Diff: &Step{ID: "diff", Image: "drone/git", Pull: PullIfNotExists, Output: "/tmp/drone_changes"},
+	}
+
+	// if the changed files cannot be computed, the path
+	// conditions are ignored.
+	step := &Step{Name: "api", Paths: &Paths{Include: []string{"api/**"}}}
+	match, err := engine.matchPaths(context.Background(), spec, step)
+	if err == nil {
+		t.Errorf("Expect error listing changed files")
+	}
+	if !match {
+		t.Errorf("Expect path conditions ignored")
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-docker/internal/docker/stdcopy"
+	"github.com/drone/runner-go/pipeline/runtime"
+
+	"github.com/docker/docker/api/types"
+)
+
+// default readiness probe settings.
+const (
+	defaultProbeInterval = time.Second
+	defaultProbeTimeout  = time.Minute
+)
+
+// gateStartTimeout is the maximum time a dependent step waits
+// for the service to start. The pipeline runtime only runs a
+// step once the services it depends on are started, which
+// means a service that is not started within the timeout was
+// skipped by the pipeline runtime.
+var gateStartTimeout = 5 * time.Second
+
+// errServiceExited is returned by the readiness probe when
+// the service container exits before it is ready.
+var errServiceExited = errors.New("service exited before it was ready")
+
+// errServiceSkipped is returned by the readiness probe when
+// the service is skipped by its path conditions, or by the
+// pipeline runtime.
+var errServiceSkipped = errors.New("service was skipped")
+
+// gate blocks dependent steps until a service is ready.
+type gate struct {
+	once    sync.Once
+	done    chan struct{}
+	err     error
+	start   sync.Once
+	started chan struct{}
+}
+
+// started marks the service as started.
+func (g *gate) markStarted() {
+	g.start.Do(func() { close(g.started) })
+}
+
+// release unblocks the dependent steps. A non-nil error
+// indicates the service is not ready.
+func (g *gate) release(err error) {
+	g.once.Do(func() {
+		g.err = err
+		close(g.done)
+	})
+}
+
+// helper function creates a readiness gate for each detached
+// step that defines a readiness probe.
+func (s *Spec) createGates() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gates = map[string]*gate{}
+	for _, step := range s.Steps {
+		// steps that never run are excluded, otherwise the
+		// dependent steps would block indefinitely.
+		if step.Detach && step.Ready != nil && step.RunPolicy != runtime.RunNever {
+			s.gates[step.Name] = &gate{
+				done:    make(chan struct{}),
+				started: make(chan struct{}),
+			}
+		}
+	}
+}
+
+// helper function returns the named readiness gate.
+func (s *Spec) gate(name string) (*gate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.gates[name]
+	return g, ok
+}
+
+// helper function blocks until the services the step depends
+// on are ready, returning an error if a service readiness
+// probe fails.
+func (e *Docker) waitReady(ctx context.Context, spec *Spec, step *Step) error {
+	for _, name := range step.DependsOn {
+		g, ok := spec.gate(name)
+		if !ok {
+			continue
+		}
+		// the service may have been skipped by the pipeline
+		// runtime, in which case it is never started and the
+		// gate is released as not ready.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.started:
+		case <-g.done:
+		case <-time.After(gateStartTimeout):
+			g.release(errServiceSkipped)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-g.done:
+		}
+		if g.err != nil {
+			return fmt.Errorf("service %s is not ready: %s", name, g.err)
+		}
+	}
+	return nil
+}
+
+// helper function probes the service until it is ready, the
+// service exits or the readiness timeout is exceeded, and then
+// releases the gate.
+func (e *Docker) probe(ctx context.Context, spec *Spec, step *Step, exited <-chan struct{}, output io.Writer) {
+	g, ok := spec.gate(step.Name)
+	if !ok {
+		return
+	}
+
+	// the gate is only released once. if the service is
+	// retried, subsequent attempts are not probed.
+	select {
+	case <-g.done:
+		return
+	default:
+	}
+
+	g.release(e.awaitReady(ctx, spec, step, exited, output))
+}
+
+// helper function probes the container until it is ready,
+// returning an error if the container exits or the readiness
+// timeout is exceeded.
+func (e *Docker) awaitReady(ctx context.Context, spec *Spec, step *Step, exited <-chan struct{}, output io.Writer) error {
+	interval := step.Ready.Interval
+	if interval == 0 {
+		interval = defaultProbeInterval
+	}
+	timeout := step.Ready.Timeout
+	if timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	expires := time.Now().Add(timeout)
+	deadline := time.After(timeout)
+
+	for {
+		// each attempt is bounded by the readiness timeout,
+		// since a probe command may never exit. an attempt
+		// that times out is a failed attempt.
+		attemptCtx, cancel := context.WithDeadline(ctx, expires)
+		err := e.probeOnce(attemptCtx, spec, step)
+		cancel()
+		if err == nil {
+			fmt.Fprintln(output, "readiness probe succeeded")
+			return nil
+		}
+		fmt.Fprintf(output, "readiness probe failed: %s\n", err)
+		if err == errServiceExited {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			fmt.Fprintf(output, "readiness probe failed: %s\n", errServiceExited)
+			return errServiceExited
+		case <-deadline:
+			fmt.Fprintf(output, "service not ready after %s\n", timeout)
+			return fmt.Errorf("readiness probe timed out after %s", timeout)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// helper function runs the readiness probe a single time.
+func (e *Docker) probeOnce(ctx context.Context, spec *Spec, step *Step) error {
+	info, err := e.client.ContainerInspect(ctx, step.ID)
+	if err != nil {
+		return err
+	}
+	if !info.State.Running {
+		return errServiceExited
+	}
+
+	switch {
+	case len(step.Ready.Command) != 0:
+		return e.probeCommand(ctx, step)
+	case step.Ready.Port != 0:
+		// the port is probed from inside the service container,
+		// since the runner is typically not attached to the
+		// pipeline network.
+		code, err := e.exec(ctx, step.ID, portCommand(step.Ready.Port))
+		switch {
+		case err == nil && code == 0:
+			return nil
+		case err == nil && code == 1:
+			return fmt.Errorf("port %d is not listening", step.Ready.Port)
+		}
+		// if the service container cannot run the probe command,
+		// the port is probed from the runner using the container
+		// address on the pipeline network, which requires the
+		// runner to be able to route to this network.
+		endpoint, ok := info.NetworkSettings.Networks[spec.Network.ID]
+		if !ok || endpoint.IPAddress == "" {
+			return errors.New("container address not found")
+		}
+		addr := net.JoinHostPort(endpoint.IPAddress, strconv.Itoa(step.Ready.Port))
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	default:
+		if info.State.Health == nil {
+			return errors.New("image does not define a healthcheck")
+		}
+		if info.State.Health.Status != types.Healthy {
+			return fmt.Errorf("container is %s", info.State.Health.Status)
+		}
+		return nil
+	}
+}
+
+// helper function runs the readiness probe command, returning
+// an error if the command exits with a non-zero exit code.
+func (e *Docker) probeCommand(ctx context.Context, step *Step) error {
+	code, err := e.exec(ctx, step.ID, step.Ready.Command)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("command exited with code %d", code)
+	}
+	return nil
+}
+
+// helper function returns a command that exits with code 0 if
+// the container is listening on the tcp port, and code 1 if it
+// is not. The command reads the container sockets from procfs,
+// and does not require a shell or network tools.
+func portCommand(port int) []string {
+	return []string{
+		"grep", "-qiE",
+		fmt.Sprintf(":%04X [0-9A-F]+:0000 0A", port),
+		"/proc/net/tcp",
+		"/proc/net/tcp6",
+	}
+}
+
+// helper function emulates the `docker exec` command, returning
+// the command exit code.
+func (e *Docker) exec(ctx context.Context, id string, cmd []string) (int, error) {
+	exec, err := e.client.ContainerExecCreate(ctx, id, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	resp, err := e.client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, err
+	}
+
+	// the attached connection does not observe the context,
+	// and is closed if the context is done before the command
+	// exits.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			resp.Close()
+		case <-done:
+		}
+	}()
+	stdcopy.StdCopy(ioutil.Discard, ioutil.Discard, resp.Reader)
+	close(done)
+	resp.Close()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	info, err := e.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return 0, err
+	}
+	return info.ExitCode, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// fakeProbeClient is a Docker client that runs a service
+// container, where the exec commands never exit.
+type fakeProbeClient struct {
+	client.APIClient
+}
+
+func (c *fakeProbeClient) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			State: &types.ContainerState{Running: true},
+		},
+	}, nil
+}
+
+func (c *fakeProbeClient) ContainerExecCreate(ctx context.Context, id string, config types.ExecConfig) (types.IDResponse, error) {
+	return types.IDResponse{ID: "exec"}, nil
+}
+
+func (c *fakeProbeClient) ContainerExecAttach(ctx context.Context, id string, config types.ExecStartCheck) (types.HijackedResponse, error) {
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(conn)}, nil
+}
+
+// This test verifies that a step does not block indefinitely
+// when the service it depends on is never started, because
+// the service is skipped by the pipeline runtime.
+func TestWaitReady_NotStarted(t *testing.T) {
+	defer func(timeout time.Duration) {
+		gateStartTimeout = timeout
+	}(gateStartTimeout)
+	gateStartTimeout = 10 * time.Millisecond
+
+	spec := &Spec{
+		Steps: []*Step{
+			{Name: "redis", Detach: true, Ready: &Ready{Port: 6379}, RunPolicy: runtime.RunOnSuccess},
+			{Name: "test", DependsOn: []string{"redis"}},
+		},
+	}
+	spec.createGates()
+
+	engine := New(new(fakeClient), Opts{})
+	err := engine.waitReady(context.Background(), spec, spec.Steps[1])
+	if err == nil {
+		t.Errorf("Expect error waiting for a service that is not started")
+		return
+	}
+	if got, want := err.Error(), "service redis is not ready: service was skipped"; got != want {
+		t.Errorf("Want error %q, got %q", want, got)
+	}
+
+	// the gate is released, and other dependent steps do
+	// not wait for the service.
+	g, _ := spec.gate("redis")
+	select {
+	case <-g.done:
+	default:
+		t.Errorf("Expect gate released for a skipped service")
+	}
+}
+
+// This test verifies that a step waits for a started service
+// until the service readiness gate is released.
+func TestWaitReady_Started(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Name: "redis", Detach: true, Ready: &Ready{Port: 6379}},
+			{Name: "test", DependsOn: []string{"redis"}},
+		},
+	}
+	spec.createGates()
+	g, _ := spec.gate("redis")
+	g.markStarted()
+	time.AfterFunc(10*time.Millisecond, func() {
+		g.release(nil)
+	})
+
+	engine := New(new(fakeClient), Opts{})
+	if err := engine.waitReady(context.Background(), spec, spec.Steps[1]); err != nil {
+		t.Error(err)
+	}
+}
+
+// This test verifies that a probe command that never exits
+// does not block the readiness probe beyond the timeout.
+func TestProbe_Timeout(t *testing.T) {
+	step := &Step{
+		ID:     "drone-redis",
+		Name:   "redis",
+		Detach: true,
+		Ready: &Ready{
+			Command:  []string{"redis-cli", "ping"},
+			Interval: 10 * time.Millisecond,
+			Timeout:  50 * time.Millisecond,
+		},
+	}
+	spec := &Spec{Steps: []*Step{step}}
+	spec.createGates()
+
+	done := make(chan struct{})
+	output := new(bytes.Buffer)
+	engine := New(new(fakeProbeClient), Opts{})
+	go func() {
+		engine.probe(context.Background(), spec, step, nil, output)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expect probe to time out")
+	}
+
+	g, _ := spec.gate("redis")
+	if g.err == nil {
+		t.Errorf("Expect service not ready")
+	}
+	if !strings.Contains(output.String(), "service not ready after 50ms") {
+		t.Errorf("Expect readiness timeout reported, got %q", output.String())
+	}
+}
+
+func TestPortCommand(t *testing.T) {
+	got := portCommand(6379)
+	if got[2] != ":18EB [0-9A-F]+:0000 0A" {
+		t.Errorf("Unexpected port pattern %q", got[2])
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-docker/internal/docker/errors"
+	"github.com/drone-runners/drone-runner-docker/internal/docker/image"
+	"github.com/drone-runners/drone-runner-docker/internal/docker/jsonmessage"
+	"github.com/drone/runner-go/logger"
+	"github.com/drone/runner-go/pipeline/runtime"
+	"github.com/drone/runner-go/registry/auths"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// pullBackoff is the initial delay before a failed image
+// pull is retried. The delay doubles after each retry.
+const pullBackoff = time.Second * 2
+
+// prepull describes an image that is pulled during setup,
+// before the pipeline steps execute.
+type prepull struct {
+	image  string
+	auth   *Auth
+	always bool
+	maxAge time.Duration
+}
+
+// pullResult records the result and the output of an image
+// pulled during setup. The output is replayed into the log of
+// the first step that uses the image.
+type pullResult struct {
+	err      error
+	output   []byte
+	replayed bool
+}
+
+// helper function returns the unique images that should be
+// pulled during setup, taking into account the pull policy
+// of each step that uses the image.
+func toPrepull(spec *Spec) []*prepull {
+	var images []*prepull
+	index := map[string]*prepull{}
+	for _, step := range append(spec.Steps, spec.Internal...) {
+		if step.RunPolicy == runtime.RunNever || step.Pull == PullNever {
+			continue
+		}
+		always := step.Pull == PullAlways ||
+			(step.Pull == PullDefault && image.IsLatest(step.Image))
+		var maxAge time.Duration
+		if step.Pull == PullIfOlderThan {
+			maxAge = step.PullMaxAge
+		}
+		if p, ok := index[step.Image]; ok {
+			p.always = p.always || always
+			if p.auth == nil {
+				p.auth = step.Auth
+			}
+			if maxAge > 0 && (p.maxAge == 0 || maxAge < p.maxAge) {
+				p.maxAge = maxAge
+			}
+			continue
+		}
+		p := &prepull{
+			image:  step.Image,
+			auth:   step.Auth,
+			always: always,
+			maxAge: maxAge,
+		}
+		index[step.Image] = p
+		images = append(images, p)
+	}
+	return images
+}
+
+// helper function pulls the pipeline images concurrently. The
+// pull errors are recorded and reported by the steps that use
+// the image, instead of failing the pipeline setup.
+func (e *Docker) prepull(ctx context.Context, spec *Spec) {
+	images := toPrepull(spec)
+	if len(images) == 0 {
+		return
+	}
+
+	spec.mu.Lock()
+	spec.pulls = map[string]*pullResult{}
+	spec.mu.Unlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, e.pullConcurrency)
+	for _, p := range images {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p *prepull) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// the pull output is buffered, since the pull is
+			// not associated with a step log.
+			output := new(bytes.Buffer)
+			pulled, err := e.prepullImage(ctx, p, output)
+			if err != nil {
+				logger.FromContext(ctx).
+					WithError(err).
+					WithField("image", p.image).
+					Debugln("cannot pre-pull image")
+			}
+			if pulled || err != nil {
+				spec.mu.Lock()
+				spec.pulls[p.image] = &pullResult{
+					err:    errors.TrimExtraInfo(err),
+					output: output.Bytes(),
+				}
+				spec.mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// helper function pulls the image if required by the pull
+// policy, and returns true if the image was pulled.
+func (e *Docker) prepullImage(ctx context.Context, p *prepull, output io.Writer) (bool, error) {
+	if !p.always && p.maxAge > 0 {
+		age, ok := e.imageAge(ctx, p.image)
+		if ok && age <= p.maxAge {
+			return false, nil
+		}
+	} else if !p.always {
+		_, _, err := e.client.ImageInspectWithRaw(ctx, p.image)
+		if err == nil {
+			return false, nil
+		}
+		if !client.IsErrNotFound(err) {
+			return false, err
+		}
+	}
+
+	if err := e.pull(ctx, p.image, p.auth, output); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// helper function emulates the `docker pull` command. If the
+// pull fails with a transient error, the pull is retried with
+// exponential backoff and each retry is written to the output.
+func (e *Docker) pull(ctx context.Context, name string, auth *Auth, output io.Writer) error {
+	// create pull options with encoded authorization credentials.
+	pullopts := types.ImagePullOptions{}
+	if auth != nil {
+		pullopts.RegistryAuth = auths.Header(
+			auth.Username,
+			auth.Password,
+		)
+	}
+
+	backoff := pullBackoff
+	for attempt := 0; ; attempt++ {
+		err := e.pullOnce(ctx, name, pullopts, output)
+		if err == nil {
+			e.history.Put(name, time.Now())
+			return nil
+		}
+		if attempt >= e.pullRetries || !errors.IsTransient(err) {
+			return err
+		}
+		fmt.Fprintf(output, "image pull failed: %s, retrying in %s (retry %d of %d)\n",
+			errors.TrimExtraInfo(err), backoff, attempt+1, e.pullRetries)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = backoff * 2
+	}
+}
+
+// helper function pulls the image a single time, returning any
+// error received while streaming the pull progress.
+func (e *Docker) pullOnce(ctx context.Context, name string, pullopts types.ImagePullOptions, output io.Writer) error {
+	rc, err := e.client.ImagePull(ctx, name, pullopts)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if e.hidePull {
+		output = ioutil.Discard
+	}
+	return jsonmessage.Copy(rc, output)
+}
+
+// helper function returns true if the image was pulled during
+// setup, and the pull error, if any. The pull output is written
+// to the output of the first step that uses the image.
+func (s *Spec) pulled(image string, output io.Writer) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result, ok := s.pulls[image]
+	if !ok {
+		return false, nil
+	}
+	if !result.replayed {
+		result.replayed = true
+		output.Write(result.output)
+	}
+	return true, result.err
+}
@@ -0,0 +1,95 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+func Test_toPrepull(t *testing.T) {
+	auth := &Auth{Username: "octocat", Password: "correct-horse-battery-staple"}
+	spec := &Spec{
+		Steps: []*Step{
+			{Image: "docker.io/library/golang:1.21", Pull: PullIfNotExists},
+			{Image: "docker.io/library/golang:1.21", Pull: PullAlways, Auth: auth},
+			{Image: "docker.io/library/node:latest"},
+			{Image: "docker.io/library/redis:6", Pull: PullNever},
+			{Image: "docker.io/library/mysql:8", RunPolicy: runtime.RunNever},
+		},
+		Internal: []*Step{
+			{Image: "drone/drone-runner-docker:1", Pull: PullIfNotExists},
+		},
+	}
+
+	got := toPrepull(spec)
+	if len(got) != 3 {
+		t.Errorf("Want 3 unique images, got %d", len(got))
+		return
+	}
+	if got[0].image != "docker.io/library/golang:1.21" || !got[0].always || got[0].auth != auth {
+		t.Errorf("Want golang image always pulled with auth")
+	}
+	if got[1].image != "docker.io/library/node:latest" || !got[1].always {
+		t.Errorf("Want latest image always pulled")
+	}
+	if got[2].image != "drone/drone-runner-docker:1" || got[2].always {
+		t.Errorf("Want internal image pulled if not exists")
+	}
+}
+
+func Test_toPrepull_MaxAge(t *testing.T) {
+	spec := &Spec{
+		Steps: []*Step{
+			{Image: "docker.io/library/node:20", Pull: PullIfOlderThan, PullMaxAge: time.Hour * 24},
+			{Image: "docker.io/library/node:20", Pull: PullIfOlderThan, PullMaxAge: time.Hour},
+			{Image: "docker.io/library/node:20", Pull: PullIfNotExists},
+		},
+	}
+	got := toPrepull(spec)
+	if len(got) != 1 {
+		t.Errorf("Want 1 unique image, got %d", len(got))
+		return
+	}
+	if got[0].always {
+		t.Errorf("Want image pulled if older than max age")
+	}
+	if got[0].maxAge != time.Hour {
+		t.Errorf("Want shortest max age, got %s", got[0].maxAge)
+	}
+}
+
+// This test verifies that the output of an image pulled during
+// setup is replayed into the log of the first step that uses
+// the image.
+func TestSpec_pulled(t *testing.T) {
+	spec := &Spec{
+		pulls: map[string]*pullResult{
+			"golang:1.21": {output: []byte("image pull failed: timeout, retrying in 2s (retry 1 of 3)\n")},
+		},
+	}
+
+	output := new(bytes.Buffer)
+	pulled, err := spec.pulled("golang:1.21", output)
+	if !pulled || err != nil {
+		t.Errorf("Expect image pulled without error")
+	}
+	if got, want := output.String(), "image pull failed: timeout, retrying in 2s (retry 1 of 3)\n"; got != want {
+		t.Errorf("Want pull output %q, got %q", want, got)
+	}
+
+	output.Reset()
+	spec.pulled("golang:1.21", output)
+	if output.Len() != 0 {
+		t.Errorf("Expect pull output replayed once, got %q", output.String())
+	}
+
+	if pulled, _ := spec.pulled("node:18", output); pulled {
+		t.Errorf("Expect image not pulled during setup")
+	}
+}
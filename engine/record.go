@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// timeRecord records a timestamp for each key, such as when
+// each image was last pulled or each cache was last used. The
+// record is optionally persisted to a local file so that it
+// survives runner restarts.
+type timeRecord struct {
+	sync.Mutex
+
+	path  string
+	times map[string]time.Time
+}
+
+// helper function returns a new record, loaded from the
+// file path if the file exists.
+func newTimeRecord(path string) *timeRecord {
+	r := &timeRecord{
+		path:  path,
+		times: map[string]time.Time{},
+	}
+	if path == "" {
+		return r
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &r.times)
+	}
+	return r
+}
+
+// Get returns the recorded time for the key.
+func (r *timeRecord) Get(key string) (time.Time, bool) {
+	r.Lock()
+	defer r.Unlock()
+	t, ok := r.times[key]
+	return t, ok
+}
+
+// Put records the time for the key, and writes the record
+// to the file path, if configured.
+func (r *timeRecord) Put(key string, t time.Time) error {
+	r.Lock()
+	defer r.Unlock()
+	r.times[key] = t
+	return r.write()
+}
+
+// Delete removes the key from the record, and writes the
+// record to the file path, if configured.
+func (r *timeRecord) Delete(key string) error {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.times, key)
+	return r.write()
+}
+
+// helper function writes the record to the file path. The
+// caller must hold the lock.
+func (r *timeRecord) write() error {
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(r.times)
+	if err != nil {
+		return err
+	}
+	// the record is written to a temporary file and renamed
+	// to prevent a partial write from corrupting the record.
+	temp := r.path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temp, r.path)
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPullRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pulls.json")
+	now := time.Now().UTC().Truncate(time.Second)
+
+	record := newTimeRecord(path)
+	if _, ok := record.Get("golang:1.21"); ok {
+		t.Errorf("Expect no record for image that was never pulled")
+	}
+	if err := record.Put("golang:1.21", now); err != nil {
+		t.Error(err)
+		return
+	}
+
+	// the record should be loaded from disk.
+	record = newTimeRecord(path)
+	got, ok := record.Get("golang:1.21")
+	if !ok {
+		t.Errorf("Expect record loaded from disk")
+	}
+	if !got.Equal(now) {
+		t.Errorf("Want pull time %s, got %s", now, got)
+	}
+}
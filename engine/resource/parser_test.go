@@ -6,6 +6,7 @@ package resource
 
 import (
 	"testing"
+	"time"
 
 	"github.com/drone/runner-go/manifest"
 
@@ -48,6 +49,13 @@ func TestParse(t *testing.T) {
 			Clone: manifest.Clone{
 				Depth: 50,
 			},
+			Cache: []*Cache{
+				{
+					Name: "go",
+					Path: "/go/pkg/mod",
+					Key:  `go-{{ checksum "go.sum" }}`,
+				},
+			},
 			Deps: []string{"dependency"},
 			PullSecrets: []string{"dockerconfigjson"},
 			Trigger: manifest.Conditions{
@@ -69,6 +77,7 @@ func TestParse(t *testing.T) {
 					Image:     "golang",
 					Detach:    false,
 					DependsOn: []string{"clone"},
+					Artifacts: []string{"coverage.out"},
 					Commands: []string{
 						"go build",
 						"go test",
@@ -79,11 +88,21 @@ func TestParse(t *testing.T) {
 					},
 					MemLimit:     manifest.BytesSize(1073741824),
 					MemSwapLimit: manifest.BytesSize(2147483648),
+					Timeout:      Duration(time.Minute * 10),
+					StopSignal:   "SIGINT",
+					StopGrace:    Duration(time.Second * 30),
 					Failure:      "ignore",
-					When: manifest.Conditions{
-						Event: manifest.Condition{
-							Include: []string{"push"},
+					Retry: &Retry{
+						Attempts: 3,
+						Delay:    Duration(time.Second * 30),
+					},
+					When: Conditions{
+						Conditions: manifest.Conditions{
+							Event: manifest.Condition{
+								Include: []string{"push"},
+							},
 						},
+						Expr: "env.DRONE_BRANCH == 'main'",
 					},
 				},
 			},
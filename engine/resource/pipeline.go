@@ -28,6 +28,7 @@ type Pipeline struct {
 	Name    string   `json:"name,omitempty"`
 	Deps    []string `json:"depends_on,omitempty" yaml:"depends_on"`
 
+	Cache       []*Cache             `json:"cache,omitempty"`
 	Clone       manifest.Clone       `json:"clone,omitempty"`
 	Concurrency manifest.Concurrency `json:"concurrency,omitempty"`
 	Node        map[string]string    `json:"node,omitempty"`
@@ -81,12 +82,26 @@ func (p *Pipeline) GetStep(name string) *Step {
 }
 
 type (
+	// Cache defines a build cache that is persisted across
+	// builds. The cache is restored from the volume matching
+	// the key, which is a template that may reference the
+	// checksum of workspace files.
+	Cache struct {
+		Name string `json:"name,omitempty"`
+		Path string `json:"path,omitempty"`
+		Key  string `json:"key,omitempty"`
+	}
+
 	// Step defines a Pipeline step.
 	Step struct {
+		Artifacts    []string                       `json:"artifacts,omitempty"`
+		CapAdd       []string                       `json:"cap_add,omitempty" yaml:"cap_add"`
+		CapDrop      []string                       `json:"cap_drop,omitempty" yaml:"cap_drop"`
 		Command      []string                       `json:"command,omitempty"`
 		Commands     []string                       `json:"commands,omitempty"`
 		Detach       bool                           `json:"detach,omitempty"`
 		DependsOn    []string                       `json:"depends_on,omitempty" yaml:"depends_on"`
+		DockerProxy  bool                           `json:"docker_proxy,omitempty" yaml:"docker_proxy"`
 		Devices      []*VolumeDevice                `json:"devices,omitempty"`
 		DNS          []string                       `json:"dns,omitempty"`
 		DNSSearch    []string                       `json:"dns_search,omitempty" yaml:"dns_search"`
@@ -95,21 +110,64 @@ type (
 		ExtraHosts   []string                       `json:"extra_hosts,omitempty" yaml:"extra_hosts"`
 		Failure      string                         `json:"failure,omitempty"`
 		Image        string                         `json:"image,omitempty"`
+		Matrix       map[string][]string            `json:"matrix,omitempty"`
 		MemLimit     manifest.BytesSize             `json:"mem_limit,omitempty" yaml:"mem_limit"`
 		MemSwapLimit manifest.BytesSize             `json:"memswap_limit,omitempty" yaml:"memswap_limit"`
 		Network      string                         `json:"network_mode,omitempty" yaml:"network_mode"`
 		Name         string                         `json:"name,omitempty"`
+		NoNewPrivs   bool                           `json:"no_new_privileges,omitempty" yaml:"no_new_privileges"`
+		PidsLimit    int64                          `json:"pids_limit,omitempty" yaml:"pids_limit"`
 		Privileged   bool                           `json:"privileged,omitempty"`
 		Pull         string                         `json:"pull,omitempty"`
+		ReadOnly     bool                           `json:"read_only,omitempty" yaml:"read_only"`
+		Runtime      string                         `json:"runtime,omitempty"`
+		Ready        *Ready                         `json:"ready,omitempty"`
+		Retry        *Retry                         `json:"retry,omitempty"`
+		SecurityOpt  []string                       `json:"security_opt,omitempty" yaml:"security_opt"`
 		Settings     map[string]*manifest.Parameter `json:"settings,omitempty"`
 		Shell        string                         `json:"shell,omitempty"`
 		ShmSize      manifest.BytesSize             `json:"shm_size,omitempty" yaml:"shm_size"`
+		StopSignal   string                         `json:"stop_signal,omitempty" yaml:"stop_signal"`
+		StopGrace    Duration                       `json:"stop_grace_period,omitempty" yaml:"stop_grace_period"`
+		Sysctls      map[string]string              `json:"sysctls,omitempty"`
+		Timeout      Duration                       `json:"timeout,omitempty"`
+		Ulimits      map[string]*Ulimit             `json:"ulimits,omitempty"`
 		User         string                         `json:"user,omitempty"`
 		Volumes      []*VolumeMount                 `json:"volumes,omitempty"`
-		When         manifest.Conditions            `json:"when,omitempty"`
+		When         Conditions                     `json:"when,omitempty"`
 		WorkingDir   string                         `json:"working_dir,omitempty" yaml:"working_dir"`
 	}
 
+	// Conditions defines the step conditions. The conditions
+	// extend the manifest conditions with an expression that
+	// is evaluated before the step runs.
+	Conditions struct {
+		manifest.Conditions `yaml:",inline"`
+
+		Expr string `json:"expr,omitempty"`
+	}
+
+	// Ready defines the service readiness probe. Steps that
+	// depend on the service do not start until the probe
+	// succeeds.
+	Ready struct {
+		Healthcheck bool     `json:"healthcheck,omitempty"`
+		Port        int      `json:"port,omitempty"`
+		Command     []string `json:"command,omitempty"`
+		Interval    Duration `json:"interval,omitempty"`
+		Timeout     Duration `json:"timeout,omitempty"`
+	}
+
+	// Retry defines the step retry policy. A failed step
+	// is re-run in a new container until it succeeds or
+	// the maximum number of attempts is reached.
+	Retry struct {
+		Attempts  int      `json:"attempts,omitempty"`
+		Delay     Duration `json:"delay,omitempty"`
+		Backoff   float64  `json:"backoff,omitempty"`
+		ExitCodes []int    `json:"exit_codes,omitempty" yaml:"exit_codes"`
+	}
+
 	// Volume that can be mounted by containers.
 	Volume struct {
 		Name     string          `json:"name,omitempty"`
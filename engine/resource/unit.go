@@ -0,0 +1,59 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import "time"
+
+// Duration stores a human-readable duration (eg. "30s",
+// "10m", "1h30m").
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml unmarshalling.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var intType int64
+	if err := unmarshal(&intType); err == nil {
+		*d = Duration(time.Duration(intType) * time.Second)
+		return nil
+	}
+
+	var stringType string
+	if err := unmarshal(&stringType); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(stringType)
+	if err == nil {
+		*d = Duration(v)
+	}
+	return err
+}
+
+// String returns a human-readable duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Ulimit stores the soft and hard limits of a ulimit. The
+// limit may be defined as a single value, which is used as
+// both the soft and hard limit.
+type Ulimit struct {
+	Soft int64 `json:"soft"`
+	Hard int64 `json:"hard"`
+}
+
+// UnmarshalYAML implements yaml unmarshalling.
+func (u *Ulimit) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var intType int64
+	if err := unmarshal(&intType); err == nil {
+		u.Soft = intType
+		u.Hard = intType
+		return nil
+	}
+
+	// the limits are unmarshalled to an alias type to
+	// prevent recursive calls to this function.
+	type limits Ulimit
+	return unmarshal((*limits)(u))
+}
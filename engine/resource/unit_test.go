@@ -0,0 +1,62 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package resource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/buildkite/yaml"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want time.Duration
+	}{
+		{yaml: "30s", want: time.Second * 30},
+		{yaml: "10m", want: time.Minute * 10},
+		{yaml: "1h30m", want: time.Minute * 90},
+		{yaml: "45", want: time.Second * 45},
+	}
+	for _, test := range tests {
+		var got Duration
+		if err := yaml.Unmarshal([]byte(test.yaml), &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if time.Duration(got) != test.want {
+			t.Errorf("Want duration %s, got %s", test.want, got)
+		}
+	}
+}
+
+func TestDuration_Error(t *testing.T) {
+	var got Duration
+	if err := yaml.Unmarshal([]byte("ten minutes"), &got); err == nil {
+		t.Errorf("Expect error when duration is invalid")
+	}
+}
+
+func TestUlimit(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want Ulimit
+	}{
+		{yaml: "1024", want: Ulimit{Soft: 1024, Hard: 1024}},
+		{yaml: "{ soft: 1024, hard: 2048 }", want: Ulimit{Soft: 1024, Hard: 2048}},
+		{yaml: "-1", want: Ulimit{Soft: -1, Hard: -1}},
+	}
+	for _, test := range tests {
+		var got Ulimit
+		if err := yaml.Unmarshal([]byte(test.yaml), &got); err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Want ulimit %v, got %v", test.want, got)
+		}
+	}
+}
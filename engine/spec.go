@@ -5,6 +5,9 @@
 package engine
 
 import (
+	"sync"
+	"time"
+
 	"github.com/drone/runner-go/environ"
 	"github.com/drone/runner-go/pipeline/runtime"
 )
@@ -18,14 +21,31 @@ type (
 		Platform Platform  `json:"platform,omitempty"`
 		Steps    []*Step   `json:"steps,omitempty"`
 		Internal []*Step   `json:"internal,omitempty"`
+		Diff     *Step     `json:"diff,omitempty"`
 		Volumes  []*Volume `json:"volumes,omitempty"`
+		Caches   []*Cache  `json:"caches,omitempty"`
 		Network  Network   `json:"network"`
+
+		mu        sync.Mutex
+		results   map[string]*Result
+		gates     map[string]*gate
+		pulls     map[string]*pullResult
+		caches    map[string]*cacheVolume
+		outputs   map[string][]*output
+		envs      map[string]string
+		changes   changes
+		stopped   bool
+		cancelled bool
 	}
 
 	// Step defines a pipeline step.
 	Step struct {
 		ID           string            `json:"id,omitempty"`
+		Artifacts    *Artifacts        `json:"artifacts,omitempty"`
 		Auth         *Auth             `json:"auth,omitempty"`
+		Caches       []string          `json:"caches,omitempty"`
+		CapAdd       []string          `json:"cap_add,omitempty"`
+		CapDrop      []string          `json:"cap_drop,omitempty"`
 		Command      []string          `json:"args,omitempty"`
 		CPUPeriod    int64             `json:"cpu_period,omitempty"`
 		CPUQuota     int64             `json:"cpu_quota,omitempty"`
@@ -38,7 +58,9 @@ type (
 		DNSSearch    []string          `json:"dns_search,omitempty"`
 		Entrypoint   []string          `json:"entrypoint,omitempty"`
 		Envs         map[string]string `json:"environment,omitempty"`
+		EnvFile      string            `json:"env_file,omitempty"`
 		ErrPolicy    runtime.ErrPolicy `json:"err_policy,omitempty"`
+		Expr         string            `json:"expr,omitempty"`
 		ExtraHosts   []string          `json:"extra_hosts,omitempty"`
 		IgnoreStdout bool              `json:"ignore_stderr,omitempty"`
 		IgnoreStderr bool              `json:"ignore_stdout,omitempty"`
@@ -49,16 +71,114 @@ type (
 		Name         string            `json:"name,omitempty"`
 		Network      string            `json:"network,omitempty"`
 		Networks     []string          `json:"networks,omitempty"`
+		NoNewPrivs   bool              `json:"no_new_privileges,omitempty"`
+		Output       string            `json:"output,omitempty"`
+		Paths        *Paths            `json:"paths,omitempty"`
+		PidsLimit    int64             `json:"pids_limit,omitempty"`
 		Privileged   bool              `json:"privileged,omitempty"`
 		Pull         PullPolicy        `json:"pull,omitempty"`
+		PullMaxAge   time.Duration     `json:"pull_max_age,omitempty"`
+		ReadOnly     bool              `json:"read_only,omitempty"`
+		Runtime      string            `json:"runtime,omitempty"`
+		Ready        *Ready            `json:"ready,omitempty"`
+		Retry        *Retry            `json:"retry,omitempty"`
 		RunPolicy    runtime.RunPolicy `json:"run_policy,omitempty"`
 		Secrets      []*Secret         `json:"secrets,omitempty"`
+		SecurityOpt  []string          `json:"security_opt,omitempty"`
 		ShmSize      int64             `json:"shm_size,omitempty"`
+		StopSignal   string            `json:"stop_signal,omitempty"`
+		StopGrace    time.Duration     `json:"stop_grace_period,omitempty"`
+		Sysctls      map[string]string `json:"sysctls,omitempty"`
+		Timeout      time.Duration     `json:"timeout,omitempty"`
+		Ulimits      []*Ulimit         `json:"ulimits,omitempty"`
 		User         string            `json:"user,omitempty"`
 		Volumes      []*VolumeMount    `json:"volumes,omitempty"`
 		WorkingDir   string            `json:"working_dir,omitempty"`
 	}
 
+	// Artifacts defines the paths exported from the step
+	// container after it exits. The paths are absolute paths
+	// or globs in the container, and are exported to the
+	// directory, relative to the runner artifact root.
+	Artifacts struct {
+		Paths     []string `json:"paths,omitempty"`
+		Workspace string   `json:"workspace,omitempty"`
+		Dir       string   `json:"dir,omitempty"`
+	}
+
+	// Cache defines a build cache that is persisted across
+	// builds in a runner-managed volume. The key template is
+	// rendered when the cache is first mounted, and files
+	// referenced by the key are relative to the workspace.
+	// A cache restored from an existing volume is mounted
+	// read-only, since the key identifies its contents.
+	Cache struct {
+		Name      string `json:"name,omitempty"`
+		Path      string `json:"path,omitempty"`
+		Key       string `json:"key,omitempty"`
+		Scope     string `json:"scope,omitempty"`
+		Workspace string `json:"workspace,omitempty"`
+	}
+
+	// Paths defines the step path conditions, which are
+	// matched against the files changed by the build.
+	Paths struct {
+		Include []string `json:"include,omitempty"`
+		Exclude []string `json:"exclude,omitempty"`
+	}
+
+	// Ulimit defines a container ulimit.
+	Ulimit struct {
+		Name string `json:"name,omitempty"`
+		Soft int64  `json:"soft"`
+		Hard int64  `json:"hard"`
+	}
+
+	// Ready defines the service readiness probe.
+	Ready struct {
+		Healthcheck bool          `json:"healthcheck,omitempty"`
+		Port        int           `json:"port,omitempty"`
+		Command     []string      `json:"command,omitempty"`
+		Interval    time.Duration `json:"interval,omitempty"`
+		Timeout     time.Duration `json:"timeout,omitempty"`
+	}
+
+	// Retry defines the step retry policy.
+	Retry struct {
+		Attempts  int           `json:"attempts,omitempty"`
+		Delay     time.Duration `json:"delay,omitempty"`
+		Backoff   float64       `json:"backoff,omitempty"`
+		ExitCodes []int         `json:"exit_codes,omitempty"`
+	}
+
+	// Result reports engine-level details about the step
+	// execution that are not captured by runtime.State. The
+	// status is success, failure or skipped, and is the only
+	// record that a step was skipped by a path condition or
+	// expression, since skipped steps exit with code 0.
+	Result struct {
+		Name      string   `json:"name,omitempty"`
+		Status    string   `json:"status,omitempty"`
+		Attempts  int      `json:"attempts,omitempty"`
+		Image     string   `json:"image,omitempty"`
+		Digest    string   `json:"digest,omitempty"`
+		Usage     *Usage   `json:"usage,omitempty"`
+		Artifacts []string `json:"artifacts,omitempty"`
+		OOMKilled bool     `json:"oom_killed,omitempty"`
+		Signal    string   `json:"signal,omitempty"`
+	}
+
+	// Usage reports the resource usage of the step container,
+	// sampled from the container stats.
+	Usage struct {
+		MemoryPeak uint64        `json:"memory_peak"`
+		CPUTime    time.Duration `json:"cpu_time"`
+		BlockRead  uint64        `json:"block_read"`
+		BlockWrite uint64        `json:"block_write"`
+		NetworkRx  uint64        `json:"network_rx"`
+		NetworkTx  uint64        `json:"network_tx"`
+	}
+
 	// Secret represents a secret variable.
 	Secret struct {
 		Name string `json:"name,omitempty"`
@@ -138,6 +258,36 @@ type (
 func (s *Spec) StepLen() int              { return len(s.Steps) }
 func (s *Spec) StepAt(i int) runtime.Step { return s.Steps[i] }
 
+// Results returns the step results recorded by the engine,
+// in the order the steps are defined in the specification.
+func (s *Spec) Results() []*Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var results []*Result
+	for _, step := range s.Steps {
+		if result, ok := s.results[step.ID]; ok {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// helper function updates the result for the given step,
+// creating the result if it does not yet exist.
+func (s *Spec) updateResult(step *Step, fn func(*Result)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.results == nil {
+		s.results = map[string]*Result{}
+	}
+	result, ok := s.results[step.ID]
+	if !ok {
+		result = &Result{Name: step.Name}
+		s.results[step.ID] = result
+	}
+	fn(result)
+}
+
 //
 // implements the Secret interface
 //
@@ -166,3 +316,35 @@ func (s *Step) Clone() runtime.Step {
 	dst.Envs = environ.Combine(s.Envs)
 	return dst
 }
+
+// helper function records that the pipeline containers are
+// being stopped.
+func (s *Spec) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+}
+
+// helper function returns true if the pipeline containers
+// are being stopped.
+func (s *Spec) stopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// helper function records that the pipeline was cancelled
+// or timed out while a step was running.
+func (s *Spec) interrupt() {
+	s.mu.Lock()
+	s.cancelled = true
+	s.mu.Unlock()
+}
+
+// helper function returns true if the pipeline was cancelled
+// or timed out while a step was running.
+func (s *Spec) interrupted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelled
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+)
+
+// collector samples the container stats while the step runs
+// and accumulates the resource usage.
+type collector struct {
+	usage   Usage
+	samples int
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// helper function starts sampling the container stats in the
+// background. The collector must be stopped to retrieve the
+// resource usage.
+func (e *Docker) collect(ctx context.Context, id string) *collector {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &collector{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(c.done)
+		stats, err := e.client.ContainerStats(ctx, id, true)
+		if err != nil {
+			return
+		}
+		defer stats.Body.Close()
+		dec := json.NewDecoder(stats.Body)
+		for {
+			sample := new(types.StatsJSON)
+			if err := dec.Decode(sample); err != nil {
+				return
+			}
+			c.usage.add(sample)
+			c.samples++
+		}
+	}()
+	return c
+}
+
+// stop stops sampling the container stats and returns the
+// resource usage, or nil if no stats sample was received.
+func (c *collector) stop() *Usage {
+	// the stats stream ends when the container stops, so we
+	// wait briefly to receive the final sample before the
+	// stream is closed.
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+	}
+	c.cancel()
+	<-c.done
+	if c.samples == 0 {
+		return nil
+	}
+	return &c.usage
+}
+
+// helper function adds the stats sample to the resource usage.
+// The stats are cumulative, so the maximum observed value is
+// retained, which ignores the empty sample that is received
+// after the container stops.
+func (u *Usage) add(sample *types.StatsJSON) {
+	peak := sample.MemoryStats.MaxUsage
+	if peak == 0 {
+		// the max usage is not reported by cgroups v2, in
+		// which case the peak is the max sampled usage.
+		peak = sample.MemoryStats.Usage
+	}
+	u.MemoryPeak = max64(u.MemoryPeak, peak)
+	u.CPUTime = time.Duration(max64(uint64(u.CPUTime), sample.CPUStats.CPUUsage.TotalUsage))
+
+	var read, write uint64
+	for _, entry := range sample.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			read += entry.Value
+		case "write":
+			write += entry.Value
+		}
+	}
+	u.BlockRead = max64(u.BlockRead, read)
+	u.BlockWrite = max64(u.BlockWrite, write)
+
+	var rx, tx uint64
+	for _, network := range sample.Networks {
+		rx += network.RxBytes
+		tx += network.TxBytes
+	}
+	u.NetworkRx = max64(u.NetworkRx, rx)
+	u.NetworkTx = max64(u.NetworkTx, tx)
+}
+
+// String returns a human-readable summary of the resource usage.
+func (u *Usage) String() string {
+	return fmt.Sprintf("peak memory %s, cpu time %s, block i/o %s read / %s written, network %s received / %s sent",
+		units.BytesSize(float64(u.MemoryPeak)),
+		u.CPUTime.Round(time.Millisecond),
+		units.BytesSize(float64(u.BlockRead)),
+		units.BytesSize(float64(u.BlockWrite)),
+		units.BytesSize(float64(u.NetworkRx)),
+		units.BytesSize(float64(u.NetworkTx)),
+	)
+}
+
+// helper function returns the larger of the two values.
+func max64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestUsage(t *testing.T) {
+	sample := new(types.StatsJSON)
+	sample.MemoryStats.Usage = 256
+	sample.MemoryStats.MaxUsage = 512
+	sample.CPUStats.CPUUsage.TotalUsage = uint64(time.Second)
+	sample.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "Read", Value: 10},
+		{Op: "Write", Value: 20},
+		{Op: "read", Value: 1},
+	}
+	sample.Networks = map[string]types.NetworkStats{
+		"eth0": {RxBytes: 100, TxBytes: 200},
+		"eth1": {RxBytes: 1, TxBytes: 2},
+	}
+
+	usage := new(Usage)
+	usage.add(sample)
+	// the empty sample received after the container stops
+	// must not reset the cumulative usage.
+	usage.add(new(types.StatsJSON))
+
+	want := &Usage{
+		MemoryPeak: 512,
+		CPUTime:    time.Second,
+		BlockRead:  11,
+		BlockWrite: 20,
+		NetworkRx:  101,
+		NetworkTx:  202,
+	}
+	if diff := cmp.Diff(want, usage); diff != "" {
+		t.Errorf(diff)
+	}
+}
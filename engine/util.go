@@ -3,3 +3,85 @@
 // that can be found in the LICENSE file.
 
 package engine
+
+import (
+	"sort"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+// helper function returns true if the exited step qualifies
+// for another attempt under the retry policy.
+func shouldRetry(retry *Retry, state *runtime.State) bool {
+	if retry == nil || state == nil {
+		return false
+	}
+	// exit code 78 instructs the runner to exit the pipeline
+	// early and is therefore never retried.
+	if state.ExitCode == 0 || state.ExitCode == 78 {
+		return false
+	}
+	if len(retry.ExitCodes) == 0 {
+		return true
+	}
+	for _, code := range retry.ExitCodes {
+		if code == state.ExitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function groups the steps in the order they are
+// stopped, which is the reverse dependency order. A step is
+// stopped before the steps it depends on, and the steps in a
+// group can be stopped concurrently.
+func stopOrder(steps []*Step) [][]*Step {
+	names := map[string]*Step{}
+	for _, step := range steps {
+		names[step.Name] = step
+	}
+
+	// the depth of a step is the length of the longest
+	// dependency chain from the step to a root step.
+	depths := map[*Step]int{}
+	var depth func(step *Step, visited map[*Step]bool) int
+	depth = func(step *Step, visited map[*Step]bool) int {
+		if d, ok := depths[step]; ok {
+			return d
+		}
+		// guard against cyclical dependencies, which are
+		// rejected by the linter.
+		if visited[step] {
+			return 0
+		}
+		visited[step] = true
+		d := 0
+		for _, name := range step.DependsOn {
+			if dep, ok := names[name]; ok {
+				if n := depth(dep, visited) + 1; n > d {
+					d = n
+				}
+			}
+		}
+		depths[step] = d
+		return d
+	}
+
+	groups := map[int][]*Step{}
+	for _, step := range steps {
+		d := depth(step, map[*Step]bool{})
+		groups[d] = append(groups[d], step)
+	}
+	var keys []int
+	for d := range groups {
+		keys = append(keys, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+
+	var order [][]*Step
+	for _, d := range keys {
+		order = append(order, groups[d])
+	}
+	return order
+}
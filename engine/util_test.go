@@ -3,3 +3,59 @@
 // that can be found in the LICENSE file.
 
 package engine
+
+import (
+	"testing"
+
+	"github.com/drone/runner-go/pipeline/runtime"
+)
+
+func Test_shouldRetry(t *testing.T) {
+	tests := []struct {
+		retry *Retry
+		code  int
+		want  bool
+	}{
+		{retry: nil, code: 1, want: false},
+		{retry: &Retry{Attempts: 3}, code: 0, want: false},
+		{retry: &Retry{Attempts: 3}, code: 1, want: true},
+		{retry: &Retry{Attempts: 3}, code: 78, want: false},
+		{retry: &Retry{Attempts: 3, ExitCodes: []int{2, 137}}, code: 137, want: true},
+		{retry: &Retry{Attempts: 3, ExitCodes: []int{2, 137}}, code: 1, want: false},
+	}
+	for i, test := range tests {
+		state := &runtime.State{Exited: true, ExitCode: test.code}
+		if got := shouldRetry(test.retry, state); got != test.want {
+			t.Errorf("Want retry %v at index %d, got %v", test.want, i, got)
+		}
+	}
+}
+
+func Test_stopOrder(t *testing.T) {
+	database := &Step{Name: "database", Detach: true}
+	clone := &Step{Name: "clone"}
+	build := &Step{Name: "build", DependsOn: []string{"clone"}}
+	test := &Step{Name: "test", DependsOn: []string{"build", "database"}}
+	lint := &Step{Name: "lint", DependsOn: []string{"clone"}}
+
+	got := stopOrder([]*Step{database, clone, build, test, lint})
+	want := [][]*Step{
+		{test},
+		{build, lint},
+		{database, clone},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Want %d groups, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Errorf("Want %d steps in group %d, got %d", len(want[i]), i, len(got[i]))
+			continue
+		}
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Errorf("Want step %s in group %d, got %s", want[i][j].Name, i, got[i][j].Name)
+			}
+		}
+	}
+}
@@ -27,3 +27,41 @@ func TrimExtraInfo(err error) error {
 	}
 	return err
 }
+
+// transient error messages returned by the registry or the
+// network that may succeed if the operation is retried.
+var transient = []string{
+	"tls handshake timeout",
+	"connection reset by peer",
+	"connection refused",
+	"i/o timeout",
+	"unexpected eof",
+	"500 internal server error",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"received unexpected http status: 5",
+}
+
+// IsTransient returns true if the error is a transient registry
+// or network error that may succeed if retried. Authentication
+// errors are never transient.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+	if t, ok := err.(interface{ Temporary() bool }); ok && t.Temporary() {
+		return true
+	}
+	s := strings.ToLower(err.Error())
+	if strings.Contains(s, "authentication is required") ||
+		strings.Contains(s, "unauthorized") {
+		return false
+	}
+	for _, match := range transient {
+		if strings.Contains(s, match) {
+			return true
+		}
+	}
+	return false
+}
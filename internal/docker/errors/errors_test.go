@@ -20,3 +20,29 @@ func TestTrimExtraInfo(t *testing.T) {
 		t.Errorf("Expect trimmed image")
 	}
 }
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: errors.New("net/http: TLS handshake timeout"), want: true},
+		{err: errors.New("read tcp 10.0.0.1:443: read: connection reset by peer"), want: true},
+		{err: errors.New("received unexpected HTTP status: 503 Service Unavailable"), want: true},
+		{err: errors.New("authentication is required"), want: false},
+		{err: errors.New("unauthorized: incorrect username or password"), want: false},
+		{err: errors.New("manifest for golang:0.0 not found"), want: false},
+		{err: temporary{}, want: true},
+	}
+	for _, test := range tests {
+		if got := IsTransient(test.err); got != test.want {
+			t.Errorf("Want transient %v for error %v", test.want, test.err)
+		}
+	}
+}
+
+type temporary struct{}
+
+func (temporary) Error() string   { return "temporary" }
+func (temporary) Temporary() bool { return true }
@@ -90,3 +90,15 @@ func MatchHostname(image, hostname string) bool {
 func IsLatest(s string) bool {
 	return strings.HasSuffix(Expand(s), ":latest")
 }
+
+// Digest returns the repository digest from the list that
+// matches the image name, in the name@digest format. If no
+// digest matches the image name an empty string is returned.
+func Digest(name string, digests ...string) string {
+	for _, digest := range digests {
+		if Match(name, digest) {
+			return digest
+		}
+	}
+	return ""
+}
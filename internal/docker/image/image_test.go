@@ -345,3 +345,39 @@ func Test_isLatest(t *testing.T) {
 		}
 	}
 }
+
+func Test_digest(t *testing.T) {
+	testdata := []struct {
+		name    string
+		digests []string
+		want    string
+	}{
+		{
+			name:    "golang:1.21",
+			digests: []string{"golang@sha256:5f5d61dcb58900bc57b230431b6367c900f9d0ce3e4ed1be7a4b6fa81b9d48b9"},
+			want:    "golang@sha256:5f5d61dcb58900bc57b230431b6367c900f9d0ce3e4ed1be7a4b6fa81b9d48b9",
+		},
+		{
+			name: "docker.io/library/golang:1.21",
+			digests: []string{
+				"gcr.io/golang@sha256:1f6d72ec5bd1e5fcebe3bd73d2ac6baa0d0f2c4fc3c9b8d4d2c3e4f5a6b7c8d9",
+				"golang@sha256:5f5d61dcb58900bc57b230431b6367c900f9d0ce3e4ed1be7a4b6fa81b9d48b9",
+			},
+			want: "golang@sha256:5f5d61dcb58900bc57b230431b6367c900f9d0ce3e4ed1be7a4b6fa81b9d48b9",
+		},
+		{
+			name:    "golang:1.21",
+			digests: []string{"octocat/golang@sha256:5f5d61dcb58900bc57b230431b6367c900f9d0ce3e4ed1be7a4b6fa81b9d48b9"},
+			want:    "",
+		},
+		{
+			name: "golang:1.21",
+			want: "",
+		},
+	}
+	for _, test := range testdata {
+		if got, want := Digest(test.name, test.digests...), test.want; got != want {
+			t.Errorf("Want image %q digest %q, got %q", test.name, want, got)
+		}
+	}
+}
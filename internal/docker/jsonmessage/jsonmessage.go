@@ -19,6 +19,12 @@ func (e *jsonError) Error() string {
 	return e.Message
 }
 
+// Temporary returns true if the registry returned a server
+// error, which may succeed if the pull is retried.
+func (e *jsonError) Temporary() bool {
+	return e.Code >= 500
+}
+
 type jsonMessage struct {
 	ID       string        `json:"id"`
 	Status   string        `json:"status"`
@@ -0,0 +1,269 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package proxy provides a filtering proxy to the Docker
+// socket, which only permits building, tagging, pushing and
+// inspecting images that belong to a single pipeline stage.
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/drone-runners/drone-runner-docker/internal/docker/image"
+)
+
+var (
+	// matches the api version prefix (e.g. /v1.40).
+	versionRE = regexp.MustCompile(`^/v[0-9.]+`)
+
+	// matches the image endpoints. The image name may
+	// contain slashes.
+	imageRE = regexp.MustCompile(`^/images/(.+)/(json|tag|push)$`)
+)
+
+// Proxy is a http.Handler that forwards permitted requests
+// to the Docker socket. Images built through the proxy are
+// labelled, and only labelled images can be tagged, pushed
+// or inspected.
+type Proxy struct {
+	// Label and Value identify the images that belong to
+	// the pipeline stage.
+	Label string
+	Value string
+
+	// Repos provides the image repositories that images can
+	// be built and tagged as. A repository ending with a
+	// slash permits all repositories in the namespace.
+	Repos []string
+
+	// Transport is used to send requests to the Docker
+	// daemon.
+	Transport http.RoundTripper
+}
+
+// New returns a new Proxy that forwards requests to the
+// Docker daemon listening on the unix socket.
+func New(socket, label, value string, repos []string) *Proxy {
+	return &Proxy{
+		Label: label,
+		Value: value,
+		Repos: repos,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := p.authorize(r); err != nil {
+		writeError(w, err)
+		return
+	}
+	proxy := &httputil.ReverseProxy{
+		Director: func(r *http.Request) {
+			r.URL.Scheme = "http"
+			r.URL.Host = "docker"
+		},
+		Transport: p.Transport,
+		// the build and push progress is streamed to the
+		// client as it is received.
+		FlushInterval: -1,
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// helper function returns an error if the request is not
+// permitted. Build requests are modified to label the
+// resulting image.
+func (p *Proxy) authorize(r *http.Request) error {
+	// the path must be clean, otherwise the path could be
+	// resolved to a different endpoint by the daemon.
+	if path.Clean(r.URL.Path) != r.URL.Path {
+		return errForbidden
+	}
+	endpoint := versionRE.ReplaceAllString(r.URL.Path, "")
+	switch {
+	case endpoint == "/_ping" && (r.Method == "GET" || r.Method == "HEAD"):
+		return nil
+	case (endpoint == "/version" || endpoint == "/info") && r.Method == "GET":
+		return nil
+	case endpoint == "/auth" && r.Method == "POST":
+		return nil
+	case endpoint == "/build" && r.Method == "POST":
+		return p.authorizeBuild(r)
+	}
+
+	match := imageRE.FindStringSubmatch(endpoint)
+	if match == nil {
+		return errForbidden
+	}
+	name, action := match[1], match[2]
+	switch {
+	case action == "json" && r.Method == "GET":
+	case action == "push" && r.Method == "POST":
+		// a push without a tag pushes all tags of the
+		// repository, including tags not built by the stage.
+		tag := r.URL.Query().Get("tag")
+		if tag == "" {
+			return fmt.Errorf("image %s cannot be pushed without a tag", name)
+		}
+		name = name + ":" + tag
+	case action == "tag" && r.Method == "POST":
+		target := r.URL.Query().Get("repo")
+		if target == "" {
+			return errForbidden
+		}
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			target = target + ":" + tag
+		}
+		if err := p.authorizeTarget(r.Context(), target); err != nil {
+			return err
+		}
+	default:
+		return errForbidden
+	}
+	exists, owned, err := p.inspect(r.Context(), name)
+	if err != nil {
+		return err
+	}
+	if exists && !owned {
+		return fmt.Errorf("image %s was not built by this pipeline", name)
+	}
+	return nil
+}
+
+// helper function authorizes the build request, and adds
+// the stage label to the image labels. The base images are
+// always pulled, and only images built by the stage can be
+// used as a build cache, which prevents the build from using
+// images on the host that were not built by the pipeline.
+func (p *Proxy) authorizeBuild(r *http.Request) error {
+	query := r.URL.Query()
+	switch mode := query.Get("networkmode"); {
+	case mode == "host", strings.HasPrefix(mode, "container:"):
+		return fmt.Errorf("build network mode %s is not permitted", mode)
+	}
+	for _, target := range query["t"] {
+		if err := p.authorizeTarget(r.Context(), target); err != nil {
+			return err
+		}
+	}
+	if s := query.Get("cachefrom"); s != "" {
+		var names []string
+		if err := json.Unmarshal([]byte(s), &names); err != nil {
+			return err
+		}
+		for _, name := range names {
+			_, owned, err := p.inspect(r.Context(), name)
+			if err != nil {
+				return err
+			}
+			if !owned {
+				return fmt.Errorf("image %s cannot be used as a build cache", name)
+			}
+		}
+	}
+	query.Set("pull", "1")
+
+	labels := map[string]string{}
+	if s := query.Get("labels"); s != "" {
+		if err := json.Unmarshal([]byte(s), &labels); err != nil {
+			return err
+		}
+	}
+	labels[p.Label] = p.Value
+	raw, _ := json.Marshal(labels)
+	query.Set("labels", string(raw))
+	r.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// helper function returns an error if the image name is not
+// in a permitted repository, or refers to an existing image
+// that was not built by the stage, which prevents the pipeline
+// from replacing images on the host.
+func (p *Proxy) authorizeTarget(ctx context.Context, name string) error {
+	if !p.permitted(name) {
+		return fmt.Errorf("image %s is not in a permitted repository", name)
+	}
+	exists, owned, err := p.inspect(ctx, name)
+	if err != nil {
+		return err
+	}
+	if exists && !owned {
+		return fmt.Errorf("image %s cannot be replaced", name)
+	}
+	return nil
+}
+
+// helper function returns true if the image name is in one
+// of the permitted repositories.
+func (p *Proxy) permitted(name string) bool {
+	repo := image.Trim(name)
+	for _, allowed := range p.Repos {
+		if strings.HasSuffix(allowed, "/") {
+			if strings.HasPrefix(repo, allowed) {
+				return true
+			}
+			continue
+		}
+		if repo == image.Trim(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function returns true if the image exists, and true
+// if the image is labelled for the stage.
+func (p *Proxy) inspect(ctx context.Context, name string) (exists, owned bool, err error) {
+	req, err := http.NewRequest("GET", "http://docker/images/"+name+"/json", nil)
+	if err != nil {
+		return false, false, err
+	}
+	res, err := p.Transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return false, false, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return false, false, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, false, fmt.Errorf("cannot inspect image %s", name)
+	}
+	out := struct {
+		Config struct {
+			Labels map[string]string
+		}
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return true, false, err
+	}
+	return true, out.Config.Labels[p.Label] == p.Value, nil
+}
+
+var errForbidden = fmt.Errorf("request not permitted by the docker proxy")
+
+// helper function writes the error using the Docker api
+// error format.
+func writeError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": err.Error(),
+	})
+}
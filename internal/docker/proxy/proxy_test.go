@@ -0,0 +1,114 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeDaemon emulates the Docker daemon image endpoints.
+func fakeDaemon(images map[string]map[string]string, requests *[]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/json") {
+			name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")
+			labels, ok := images[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"Config": map[string]interface{}{"Labels": labels},
+			})
+			return
+		}
+		*requests = append(*requests, r.Method+" "+r.URL.RequestURI())
+	})
+}
+
+func TestProxy(t *testing.T) {
+	images := map[string]map[string]string{
+		"octocat/hello-world:latest": {"io.drone.proxy": "stage"},
+		"octocat/hello-world:1":      {"io.drone.proxy": "stage"},
+		"golang:1.14":                {},
+	}
+	var requests []string
+	daemon := httptest.NewServer(fakeDaemon(images, &requests))
+	defer daemon.Close()
+
+	p := &Proxy{
+		Label:     "io.drone.proxy",
+		Value:     "stage",
+		Repos:     []string{"octocat/", "quay.io/octocat/hello-world"},
+		Transport: &rewriteTransport{host: daemon.Listener.Addr().String()},
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/_ping", 200},
+		{"GET", "/v1.40/version", 200},
+		{"POST", "/v1.40/build?t=octocat/hello-world:latest", 200},
+		{"POST", "/v1.40/build?t=quay.io/octocat/hello-world:1", 200},
+		{"POST", "/v1.40/build?t=golang:1.14", 403},
+		{"POST", "/v1.40/build?t=golang:1.15", 403},
+		{"POST", "/v1.40/build?t=quay.io/octocat/other", 403},
+		{"POST", "/v1.40/build?networkmode=host", 403},
+		{"POST", "/v1.40/build?t=octocat/hello-world:latest&cachefrom=" + url.QueryEscape(`["octocat/hello-world:latest"]`), 200},
+		{"POST", "/v1.40/build?t=octocat/hello-world:latest&cachefrom=" + url.QueryEscape(`["golang:1.14"]`), 403},
+		{"POST", "/v1.40/build?t=octocat/hello-world:latest&cachefrom=" + url.QueryEscape(`["golang:1.15"]`), 403},
+		{"POST", "/v1.40/images/octocat/hello-world/push?tag=latest", 200},
+		{"POST", "/v1.40/images/octocat/hello-world/push", 403},
+		{"POST", "/v1.40/images/octocat/hello-world:latest/tag?repo=octocat/hello-world&tag=1", 200},
+		{"POST", "/v1.40/images/octocat/hello-world:latest/tag?repo=octocat/hello-world&tag=2", 200},
+		{"POST", "/v1.40/images/octocat/hello-world:latest/tag?repo=golang&tag=1.14", 403},
+		{"POST", "/v1.40/images/octocat/hello-world:latest/tag?repo=golang&tag=1.15", 403},
+		{"POST", "/v1.40/images/golang/push?tag=1.14", 403},
+		{"GET", "/v1.40/images/golang:1.14/json", 403},
+		{"DELETE", "/v1.40/images/octocat/hello-world:latest", 403},
+		{"POST", "/v1.40/containers/create", 403},
+		{"POST", "/v1.40/images/x/../../containers/create/tag", 403},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(test.method, test.path, nil)
+		p.ServeHTTP(w, r)
+		if got, want := w.Code, test.code; got != want {
+			t.Errorf("Want status %d for %s %s, got %d", want, test.method, test.path, got)
+		}
+	}
+
+	// the build request is labelled, which allows the image
+	// to be tagged and pushed, and always pulls the base image.
+	var labelled, pulled bool
+	for _, request := range requests {
+		if strings.HasPrefix(request, "POST /v1.40/build") {
+			labelled = strings.Contains(request, "labels=%7B%22io.drone.proxy%22%3A%22stage%22%7D")
+			pulled = strings.Contains(request, "pull=1")
+		}
+	}
+	if !labelled {
+		t.Errorf("Expect build request labelled, got %v", requests)
+	}
+	if !pulled {
+		t.Errorf("Expect build request to pull the base image, got %v", requests)
+	}
+}
+
+// rewriteTransport sends requests to the test server.
+type rewriteTransport struct {
+	host string
+}
+
+func (t *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Host = t.host
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,352 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+// Package expr implements the expression language used to
+// evaluate step conditions at runtime.
+//
+// Expressions compare environment variables, step outputs and
+// the status of named steps:
+//
+//	steps.test.status == 'failure' && env.DRONE_BRANCH == 'main'
+//
+// The supported operators are ==, !=, &&, || and !, and
+// expressions may be grouped with parentheses. Variables are
+// referenced as env.NAME, steps.NAME.status and
+// steps.NAME.outputs.NAME. A variable or string used as a
+// boolean is true if it is not empty and not equal to false.
+//
+// A step can only be referenced by the steps that depend on it,
+// directly or transitively. Steps that define a matrix cannot
+// be referenced, since each matrix combination runs as a
+// separate step.
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Resolver returns the value of the named variable. Undefined
+// variables resolve to an empty string.
+type Resolver func(name string) string
+
+// Expr is a parsed expression.
+type Expr struct {
+	raw  string
+	root node
+}
+
+// Parse parses the expression.
+func Parse(s string) (*Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected %s", tok)
+	}
+	return &Expr{raw: s, root: root}, nil
+}
+
+// Eval evaluates the expression, resolving variables with the
+// resolver function.
+func (e *Expr) Eval(fn Resolver) bool {
+	return truthy(e.root.eval(fn))
+}
+
+// Vars returns the names of the variables referenced by the
+// expression, in the order they appear.
+func (e *Expr) Vars() []string {
+	return vars(e.root, nil)
+}
+
+// String returns the expression source.
+func (e *Expr) String() string {
+	return e.raw
+}
+
+//
+// evaluation
+//
+
+type node interface {
+	eval(Resolver) string
+}
+
+type (
+	// literal is a string or boolean literal.
+	literal struct {
+		value string
+	}
+
+	// variable is a reference to a named variable.
+	variable struct {
+		name string
+	}
+
+	// not negates the operand.
+	not struct {
+		x node
+	}
+
+	// binary is a comparison or logical operation.
+	binary struct {
+		op   string
+		x, y node
+	}
+)
+
+func (n *literal) eval(Resolver) string    { return n.value }
+func (n *variable) eval(r Resolver) string { return r(n.name) }
+func (n *not) eval(r Resolver) string      { return bool2str(!truthy(n.x.eval(r))) }
+
+func (n *binary) eval(r Resolver) string {
+	switch n.op {
+	case "&&":
+		return bool2str(truthy(n.x.eval(r)) && truthy(n.y.eval(r)))
+	case "||":
+		return bool2str(truthy(n.x.eval(r)) || truthy(n.y.eval(r)))
+	case "==":
+		return bool2str(n.x.eval(r) == n.y.eval(r))
+	default:
+		return bool2str(n.x.eval(r) != n.y.eval(r))
+	}
+}
+
+func vars(n node, names []string) []string {
+	switch n := n.(type) {
+	case *variable:
+		names = append(names, n.name)
+	case *not:
+		names = vars(n.x, names)
+	case *binary:
+		names = vars(n.x, names)
+		names = vars(n.y, names)
+	}
+	return names
+}
+
+func truthy(s string) bool {
+	return s != "" && s != "false"
+}
+
+func bool2str(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+//
+// parsing
+//
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOp, "||") {
+		p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(tokenOp, "&&") {
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peek().is(tokenOp, "!") {
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &not{x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.is(tokenOp, "==") || tok.is(tokenOp, "!=") {
+		p.next()
+		y, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return &binary{op: tok.value, x: x, y: y}, nil
+	}
+	return x, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch {
+	case tok.is(tokenOp, "("):
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); !tok.is(tokenOp, ")") {
+			return nil, fmt.Errorf("expected ) but found %s", tok)
+		}
+		return x, nil
+	case tok.kind == tokenString:
+		return &literal{value: tok.value}, nil
+	case tok.kind == tokenIdent && (tok.value == "true" || tok.value == "false"):
+		return &literal{value: tok.value}, nil
+	case tok.kind == tokenIdent:
+		if err := checkVariable(tok.value); err != nil {
+			return nil, err
+		}
+		return &variable{name: tok.value}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s", tok)
+	}
+}
+
+// helper function returns an error if the variable is not
+// an environment variable, step status or step output.
+func checkVariable(name string) error {
+	parts := strings.Split(name, ".")
+	switch {
+	case parts[0] == "env" && len(parts) == 2 && parts[1] != "":
+		return nil
+	case parts[0] == "steps" && len(parts) == 3 && parts[1] != "" && parts[2] == "status":
+		return nil
+	case parts[0] == "steps" && len(parts) == 4 && parts[1] != "" && parts[2] == "outputs" && parts[3] != "":
+		return nil
+	}
+	return fmt.Errorf("unknown variable %s", name)
+}
+
+//
+// lexing
+//
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenOp
+	tokenString
+	tokenIdent
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+func (t token) is(kind tokenKind, value string) bool {
+	return t.kind == kind && t.value == value
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return fmt.Sprintf("string %q", t.value)
+	default:
+		return t.value
+	}
+}
+
+// errUnterminated is returned when a string literal is not
+// terminated.
+var errUnterminated = errors.New("unterminated string")
+
+func lex(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, token{tokenOp, string(c)})
+			i++
+		case strings.HasPrefix(s[i:], "=="),
+			strings.HasPrefix(s[i:], "!="),
+			strings.HasPrefix(s[i:], "&&"),
+			strings.HasPrefix(s[i:], "||"):
+			tokens = append(tokens, token{tokenOp, s[i : i+2]})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{tokenOp, "!"})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				return nil, errUnterminated
+			}
+			tokens = append(tokens, token{tokenString, s[i+1 : i+1+end]})
+			i += end + 2
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(s) && isIdent(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q", c)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF}), nil
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isIdent(c byte) bool {
+	return isIdentStart(c) || ('0' <= c && c <= '9') || c == '.' || c == '-'
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 Drone.IO Inc. All rights reserved.
+// Use of this source code is governed by the Polyform License
+// that can be found in the LICENSE file.
+
+package expr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]string{
+		"env.DRONE_BRANCH":            "main",
+		"env.DEBUG":                   "false",
+		"steps.test.status":           "failure",
+		"steps.build.outputs.VERSION": "1.2.3",
+	}
+	resolve := func(name string) string {
+		return vars[name]
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"steps.test.status == 'failure' && env.DRONE_BRANCH == 'main'", true},
+		{"steps.test.status == 'failure' && env.DRONE_BRANCH == 'dev'", false},
+		{`env.DRONE_BRANCH != "main" || steps.build.outputs.VERSION == "1.2.3"`, true},
+		{"!(steps.test.status == 'success')", true},
+		{"env.DEBUG", false},
+		{"!env.DEBUG", true},
+		{"env.DRONE_BRANCH", true},
+		{"env.UNDEFINED", false},
+		{"env.UNDEFINED == ''", true},
+		{"true && !false", true},
+		{"false || true && false", false},
+	}
+	for _, test := range tests {
+		expr, err := Parse(test.expr)
+		if err != nil {
+			t.Errorf("Cannot parse %q: %s", test.expr, err)
+			continue
+		}
+		if got := expr.Eval(resolve); got != test.want {
+			t.Errorf("Want %q evaluated %v, got %v", test.expr, test.want, got)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	expr, err := Parse("!(steps.test.status == 'failure') && env.DRONE_BRANCH == steps.version.outputs.BRANCH")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"steps.test.status", "env.DRONE_BRANCH", "steps.version.outputs.BRANCH"}
+	if got := expr.Vars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Want variables %v, got %v", want, got)
+	}
+}
+
+func TestParse_Error(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression"},
+		{"env.DRONE_BRANCH ==", "unexpected end of expression"},
+		{"(env.DRONE_BRANCH == 'main'", "expected ) but found end of expression"},
+		{"env.DRONE_BRANCH == 'main", "unterminated string"},
+		{"DRONE_BRANCH == 'main'", "unknown variable DRONE_BRANCH"},
+		{"steps.test.exit_code == '1'", "unknown variable steps.test.exit_code"},
+		{"env.DRONE_BRANCH = 'main'", "unexpected character '='"},
+		{"env.A == 'a' env.B", "unexpected env.B"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.expr)
+		if err == nil {
+			t.Errorf("Expect error parsing %q", test.expr)
+			continue
+		}
+		if got, want := err.Error(), test.err; got != want {
+			t.Errorf("Want error %q parsing %q, got %q", want, test.expr, got)
+		}
+	}
+}